@@ -16,14 +16,17 @@ package apiv3
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"log"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/jasacloud/go-libraries/db"
 	"github.com/jasacloud/go-libraries/helper"
+	"github.com/jasacloud/go-libraries/utils/content"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -215,14 +218,29 @@ type Claims struct {
 	CredentialId string `json:"credential_id" bson:"credential_id"`
 }
 
-// ParseRequest function
+// ParseRequest function binds the request body by its Content-Type: JSON by default, MessagePack, CBOR or XML,
+// the other formats are bound and validated as their JSON document would be
 func ParseRequest(c *gin.Context) (*Request, error) {
 	once.Do(helper.JsonTagNameFunc)
 	var request Request
-	err := c.ShouldBindJSON(&request)
+	mediaType := content.MediaType(c.ContentType())
+	if mediaType == "" || mediaType == content.MIMEJSON {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			return nil, err
+		}
+		return &request, nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	body, err = content.ToJSON(mediaType, body)
 	if err != nil {
 		return nil, err
 	}
+	if err := binding.JSON.BindBody(body, &request); err != nil {
+		return nil, err
+	}
 
 	return &request, nil
 }
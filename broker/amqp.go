@@ -14,9 +14,12 @@
 package broker
 
 import (
+	"errors"
 	"fmt"
 	"github.com/jasacloud/go-libraries/config"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
+	"sync"
 )
 
 // AmqpConf struct
@@ -26,8 +29,8 @@ type AmqpConf struct {
 
 // AmqpOption struct
 type AmqpOption struct {
-	Name       string `json:"name" bson:"name"`
-	ConnString string `json:"connString" bson:"connString"`
+	Name       string `json:"name" bson:"name" validate:"required"`
+	ConnString string `json:"connString" bson:"connString" validate:"required" secret:"true"`
 }
 
 // AmqpConsumerConf struct
@@ -53,8 +56,8 @@ var (
 
 // AmqpConsumerOption struct
 type AmqpConsumerOption struct {
-	Name         string `json:"name" bson:"name"`
-	ConnString   string `json:"connString" bson:"connString"`
+	Name         string `json:"name" bson:"name" validate:"required"`
+	ConnString   string `json:"connString" bson:"connString" secret:"true"`
 	HttpResource string `json:"httpResource" bson:"httpResource"`
 	Threads      int    `json:"threads" bson:"threads"`
 	Exchange     string `json:"exchange" bson:"exchange"`
@@ -66,69 +69,97 @@ type AmqpConsumerOption struct {
 	ReConnect    int    `json:"reConnectSecInterval" bson:"reConnectSecInterval"`
 }
 
+func init() {
+	config.RegisterResources("rabitmqResources", AmqpOption{})
+	config.RegisterResources("amqpConsumerResources", AmqpConsumerOption{})
+	config.RegisterCloser("amqp", CloseAmqp)
+}
+
 var (
-	// Amqp type
+	// Amqp variable is not updated anymore, use GetAmqpResource which reads the current config
 	Amqp AmqpConf
-	// AmqpConsumer type
+	// AmqpConsumer variable is not updated anymore, use GetConsumerResource which reads the current config
 	AmqpConsumer AmqpConsumerConf
 )
 
 // AmqpConn variable
 var AmqpConn = make(map[string]*amqp.Connection)
 
+// amqpMu guards AmqpConn
+var amqpMu sync.Mutex
+
 //var AmqpCloseErr = make(map[string] chan *amqp.Error)
 //var AmqpErr = make(map[string] chan *amqp.Error)
 
 // GetAmqpResource function
 func GetAmqpResource(resourceName string) AmqpOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Amqp)
-	for _, v := range Amqp.AmqpOption {
-		if v.Name == resourceName {
-
-			return v
-		}
+	r, err := config.Resource[AmqpOption]("rabitmqResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load amqp resource "+resourceName+", error: ", err)
 	}
 
-	return AmqpOption{}
+	return r
 }
 
 // GetConsumerResource function
 func GetConsumerResource(resourceName string) AmqpConsumerOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &AmqpConsumer)
-	for _, v := range AmqpConsumer.AmqpConsumerOption {
-		if v.Name == resourceName {
-
-			return v
-		}
+	r, err := config.Resource[AmqpConsumerOption]("amqpConsumerResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load amqp consumer resource "+resourceName+", error: ", err)
 	}
 
-	return AmqpConsumerOption{}
+	return r
 }
 
 // AmqpConnect function
 func AmqpConnect(resourceName string) *amqp.Connection {
+	amqpMu.Lock()
+	current := AmqpConn[resourceName]
+	amqpMu.Unlock()
+	if current != nil {
+		ch, err := current.Channel()
+		if err == nil {
+			ch.Close()
+			return current
+		}
+		fmt.Println("Reconnect... on error :", err)
+	}
+
 	c := GetAmqpResource(resourceName)
+	conn, err := amqp.Dial(c.ConnString)
+	if err != nil {
+		fmt.Println("Failed to connect to RabbitMQ:", err)
+	}
 
-	if AmqpConn[resourceName] != nil {
-		ch, err := AmqpConn[resourceName].Channel()
-		if err != nil {
-			fmt.Println("Reconnect... on error :", err)
-			AmqpConn[resourceName] = nil
-			//AmqpErr[resourceName] = make(chan *amqp.Error)
-			return AmqpConnect(resourceName)
+	amqpMu.Lock()
+	defer amqpMu.Unlock()
+	// another caller may have reconnected while this one was dialing
+	if stored := AmqpConn[resourceName]; stored != nil && stored != current {
+		if conn != nil {
+			_ = conn.Close()
 		}
-		ch.Close()
+		return stored
+	}
+	AmqpConn[resourceName] = conn
+	registerAmqpHealth(resourceName)
+	//AmqpErr[resourceName] = make(chan *amqp.Error)
+
+	return conn
+}
 
-	} else {
-		conn, err := amqp.Dial(c.ConnString)
-		if err != nil {
-			fmt.Println("Failed to connect to RabbitMQ:", err)
+// CloseAmqp function closes every amqp connection
+func CloseAmqp() error {
+	amqpMu.Lock()
+	defer amqpMu.Unlock()
+	var errs []error
+	for name, conn := range AmqpConn {
+		if conn != nil && !conn.IsClosed() {
+			if err := conn.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
 		}
-		AmqpConn[resourceName] = conn
-		//AmqpErr[resourceName] = make(chan *amqp.Error)
+		delete(AmqpConn, name)
 	}
 
-	return AmqpConn[resourceName]
+	return errors.Join(errs...)
 }
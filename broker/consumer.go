@@ -125,7 +125,7 @@ func (c *Consumer) Connect() error {
 }
 
 // AnnounceQueue sets the queue that will be listened to for this
-// connection...
+// connection... Count the handled deliveries with CountConsumed.
 func (c *Consumer) AnnounceQueue(queueName, bindingKey string) (<-chan amqp.Delivery, error) {
 	log.Printf("declared Exchange, declaring Queue %q", queueName)
 	queue, err := c.channel.QueueDeclare(
@@ -0,0 +1,49 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"github.com/jasacloud/go-libraries/health"
+)
+
+// registerNatsHealth function registers the readiness check of the nats resource
+func registerNatsHealth(resourceName string) {
+	health.Register("nats:"+resourceName, func(ctx context.Context) error {
+		natsMu.Lock()
+		nc := NatsConn[resourceName]
+		natsMu.Unlock()
+		if nc == nil {
+			return errors.New("not connected")
+		}
+		if !nc.IsConnected() {
+			return errors.New("connection " + nc.Status().String())
+		}
+		return nil
+	})
+}
+
+// registerAmqpHealth function registers the readiness check of the amqp resource
+func registerAmqpHealth(resourceName string) {
+	health.Register("amqp:"+resourceName, func(ctx context.Context) error {
+		amqpMu.Lock()
+		conn := AmqpConn[resourceName]
+		amqpMu.Unlock()
+		if conn == nil || conn.IsClosed() {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package broker
+
+import (
+	"context"
+	"github.com/jasacloud/go-libraries/metrics"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func init() {
+	_ = metrics.Register(natsCollector{})
+}
+
+var (
+	natsMessagesDesc = prometheus.NewDesc("broker_nats_connection_messages_total",
+		"Number of the messages received and sent by the nats connections.", []string{"resource", "direction"}, nil)
+	natsBytesDesc = prometheus.NewDesc("broker_nats_connection_bytes_total",
+		"Number of the bytes received and sent by the nats connections.", []string{"resource", "direction"}, nil)
+)
+
+// natsCollector struct exports the statistics of the NatsConn connections, they count every
+// message of the connections, also the ones not published or subscribed by this package
+type natsCollector struct{}
+
+// Describe method
+func (natsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- natsMessagesDesc
+	ch <- natsBytesDesc
+}
+
+// Collect method
+func (natsCollector) Collect(ch chan<- prometheus.Metric) {
+	natsMu.Lock()
+	defer natsMu.Unlock()
+	for name, nc := range NatsConn {
+		if nc == nil {
+			continue
+		}
+		s := nc.Stats()
+		ch <- prometheus.MustNewConstMetric(natsMessagesDesc, prometheus.CounterValue, float64(s.InMsgs), name, "in")
+		ch <- prometheus.MustNewConstMetric(natsMessagesDesc, prometheus.CounterValue, float64(s.OutMsgs), name, "out")
+		ch <- prometheus.MustNewConstMetric(natsBytesDesc, prometheus.CounterValue, float64(s.InBytes), name, "in")
+		ch <- prometheus.MustNewConstMetric(natsBytesDesc, prometheus.CounterValue, float64(s.OutBytes), name, "out")
+	}
+}
+
+// CountConsumed function counts a message consumed from the destination, e.g. the queue, of the broker.
+// Call it for each delivery received from AmqpConsume or Consumer.AnnounceQueue.
+func CountConsumed(broker, destination string) {
+	metrics.BrokerMessagesConsumed.WithLabelValues(broker, destination).Inc()
+}
+
+// AmqpPublish function publishes the message on a new channel of the amqp resource and counts it
+// by exchange, or by queue name for the default exchange
+func AmqpPublish(resourceName, exchange, key string, msg amqp.Publishing) error {
+	err := amqpPublish(resourceName, exchange, key, msg)
+	destination := exchange
+	if destination == "" {
+		destination = key
+	}
+	metrics.BrokerMessagesPublished.WithLabelValues("amqp", destination, metrics.Status(err)).Inc()
+
+	return err
+}
+
+// amqpPublish function
+func amqpPublish(resourceName, exchange, key string, msg amqp.Publishing) error {
+	conn := AmqpConnect(resourceName)
+	if conn == nil {
+		return amqp.ErrClosed
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return ch.PublishWithContext(context.Background(), exchange, key, false, false, msg)
+}
+
+// AmqpConsume function consumes the queue on a new channel of the amqp resource, the deliveries
+// are acknowledged on receipt and counted by the caller with CountConsumed. Close the channel to stop consuming.
+func AmqpConsume(resourceName, queue string) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	conn := AmqpConnect(resourceName)
+	if conn == nil {
+		return nil, nil, amqp.ErrClosed
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	deliveries, err := ch.Consume(queue, "", true, false, false, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, err
+	}
+
+	return ch, deliveries, nil
+}
+
+// NatsPublish function publishes data on the subject of the nats resource and counts it by resource,
+// subjects often carry ids that would make too many series
+func NatsPublish(resourceName, subject string, data []byte) error {
+	err := nats.ErrConnectionClosed
+	if nc := NatsConnect(resourceName); nc != nil {
+		err = nc.Publish(subject, data)
+	}
+	metrics.BrokerMessagesPublished.WithLabelValues("nats", resourceName, metrics.Status(err)).Inc()
+
+	return err
+}
+
+// NatsSubscribe function subscribes the handler to the subject of the nats resource and counts the messages
+// by the subscribed subject, wildcards included, not by the subject of each message
+func NatsSubscribe(resourceName, subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	nc := NatsConnect(resourceName)
+	if nc == nil {
+		return nil, nats.ErrConnectionClosed
+	}
+	consumed := metrics.BrokerMessagesConsumed.WithLabelValues("nats", subject)
+
+	return nc.Subscribe(subject, func(msg *nats.Msg) {
+		consumed.Inc()
+		handler(msg)
+	})
+}
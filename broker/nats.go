@@ -14,10 +14,13 @@
 package broker
 
 import (
+	"errors"
 	"fmt"
 	"github.com/jasacloud/go-libraries/config"
 	"github.com/nats-io/nats.go"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,46 +31,71 @@ type NatsConf struct {
 
 // NatsOption struct
 type NatsOption struct {
-	Name              string `json:"name" bson:"name"`
-	ConnString        string `json:"connString" bson:"connString"`
+	Name              string `json:"name" bson:"name" validate:"required"`
+	ConnString        string `json:"connString" bson:"connString" validate:"required" secret:"true"`
 	MaxReconnectSec   int    `json:"maxReconnectSec" bson:"maxReconnectSec"`
 	ReconnectDelaySec int    `json:"reconnectDelaySec" bson:"reconnectDelaySec"`
 }
 
+func init() {
+	config.RegisterResources("natsResources", NatsOption{})
+	config.RegisterCloser("nats", CloseNats)
+}
+
 var (
-	// Nats variable
+	// Nats variable is not updated anymore, use GetNatsResource which reads the current config
 	Nats NatsConf
 )
 
 // NatsConn variable
 var NatsConn = make(map[string]*nats.Conn)
 
+var (
+	// natsMu guards NatsConn
+	natsMu sync.Mutex
+	// natsClosing is set by CloseNats so the closed handler does not exit the process
+	natsClosing atomic.Bool
+)
+
 // GetNatsResource function
 func GetNatsResource(resourceName string) NatsOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Nats)
-	for _, v := range Nats.NatsOption {
-		if v.Name == resourceName {
-
-			return v
-		}
+	r, err := config.Resource[NatsOption]("natsResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load nats resource "+resourceName+", error: ", err)
 	}
-	return NatsOption{}
+
+	return r
 }
 
 // NatsConnect function
 func NatsConnect(resourceName string) *nats.Conn {
+	natsMu.Lock()
+	nc := NatsConn[resourceName]
+	natsMu.Unlock()
+	if nc != nil {
+		return nc
+	}
 
-	if NatsConn[resourceName] == nil {
-		c := GetNatsResource(resourceName)
-		nc, err := nats.Connect(c.ConnString, setupConnOptions(c)...)
-		if err != nil {
-			fmt.Println("Failed to connect to NATS:", err)
+	c := GetNatsResource(resourceName)
+	nc, err := nats.Connect(c.ConnString, setupConnOptions(c)...)
+	if err != nil {
+		fmt.Println("Failed to connect to NATS:", err)
+	}
+
+	natsMu.Lock()
+	defer natsMu.Unlock()
+	// another caller may have connected while this one was dialing
+	if stored := NatsConn[resourceName]; stored != nil {
+		if nc != nil {
+			nc.SetClosedHandler(nil)
+			nc.Close()
 		}
-		NatsConn[resourceName] = nc
+		return stored
 	}
+	NatsConn[resourceName] = nc
+	registerNatsHealth(resourceName)
 
-	return NatsConn[resourceName]
+	return nc
 }
 
 // setupConnOptions function
@@ -85,7 +113,29 @@ func setupConnOptions(opt NatsOption) []nats.Option {
 		log.Printf("Reconnected [%s]", nc.ConnectedUrl())
 	}))
 	opts = append(opts, nats.ClosedHandler(func(nc *nats.Conn) {
+		if natsClosing.Load() {
+			return
+		}
 		log.Fatal("Exiting, no servers available")
 	}))
 	return opts
 }
+
+// CloseNats function flushes and closes every nats connection
+func CloseNats() error {
+	natsMu.Lock()
+	defer natsMu.Unlock()
+	natsClosing.Store(true)
+	var errs []error
+	for name, nc := range NatsConn {
+		if nc != nil && !nc.IsClosed() {
+			if err := nc.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			nc.Close()
+		}
+		delete(NatsConn, name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -14,8 +14,13 @@
 package cache
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-contrib/cache/persistence"
+	"github.com/gomodule/redigo/redis"
 	"github.com/jasacloud/go-libraries/config"
+	"log"
+	"sync"
 	"time"
 )
 
@@ -31,23 +36,29 @@ type RedisConf struct {
 
 // MemcachedOption struct
 type MemcachedOption struct {
-	Name          string   `json:"name" bson:"name"`
-	Host          []string `json:"host" bson:"host"`
+	Name          string   `json:"name" bson:"name" validate:"required"`
+	Host          []string `json:"host" bson:"host" validate:"required,min=1"`
 	ExpirationSec int      `json:"expiration" bson:"expiration"`
 }
 
 // RedisOption struct
 type RedisOption struct {
-	Name          string `json:"name" bson:"name"`
-	Host          string `json:"host" bson:"host"`
-	Password      string `json:"password" bson:"password"`
+	Name          string `json:"name" bson:"name" validate:"required"`
+	Host          string `json:"host" bson:"host" validate:"required"`
+	Password      string `json:"password" bson:"password" secret:"true"`
 	ExpirationSec int    `json:"expiration" bson:"expiration"`
 }
 
+func init() {
+	config.RegisterResources("memcachedResources", MemcachedOption{})
+	config.RegisterResources("redisResources", RedisOption{})
+	config.RegisterCloser("cache", CloseAll)
+}
+
 var (
-	// Memcached variable
+	// Memcached variable is not updated anymore, use GetMemcachedResource which reads the current config
 	Memcached MemcachedConf
-	// Redis variable
+	// Redis variable is not updated anymore, use GetRedisResource which reads the current config
 	Redis RedisConf
 )
 
@@ -57,38 +68,42 @@ var Mc = make(map[string]*persistence.MemcachedStore)
 //Rd variable
 var Rd = make(map[string]*persistence.RedisStore)
 
+var (
+	// storesMu guards Mc and Rd
+	storesMu sync.Mutex
+	rdPoolMu sync.Mutex
+	rdPool   = make(map[string]*redis.Pool)
+)
+
 // GetMemcachedResource function
 func GetMemcachedResource(resourceName string) MemcachedOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Memcached)
-	for _, v := range Memcached.CacheOptions {
-		if v.Name == resourceName {
-			return v
-		}
+	r, err := config.Resource[MemcachedOption]("memcachedResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load memcached resource "+resourceName+", error: ", err)
 	}
 
-	return MemcachedOption{}
+	return r
 }
 
 // GetRedisResource function
 func GetRedisResource(resourceName string) RedisOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Redis)
-	for _, v := range Redis.CacheOptions {
-		if v.Name == resourceName {
-			return v
-		}
+	r, err := config.Resource[RedisOption]("redisResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load redis resource "+resourceName+", error: ", err)
 	}
 
-	return RedisOption{}
+	return r
 }
 
 // McConnect function
 func McConnect(resourceName string) *persistence.MemcachedStore {
 	c := GetMemcachedResource(resourceName)
 
+	storesMu.Lock()
+	defer storesMu.Unlock()
 	if Mc[resourceName] == nil {
 		Mc[resourceName] = persistence.NewMemcachedStore(c.Host, time.Second*time.Duration(c.ExpirationSec))
+		registerMemcachedHealth(resourceName)
 	}
 
 	return Mc[resourceName]
@@ -98,9 +113,81 @@ func McConnect(resourceName string) *persistence.MemcachedStore {
 func RdConnect(resourceName string) *persistence.RedisStore {
 	c := GetRedisResource(resourceName)
 
+	storesMu.Lock()
+	defer storesMu.Unlock()
 	if Rd[resourceName] == nil {
-		Rd[resourceName] = persistence.NewRedisCache(c.Host, c.Password, time.Second*time.Duration(c.ExpirationSec))
+		Rd[resourceName] = persistence.NewRedisCacheWithPool(RdPool(resourceName), time.Second*time.Duration(c.ExpirationSec))
+		registerRedisHealth(resourceName)
 	}
 
 	return Rd[resourceName]
 }
+
+// RdPool function returns the connection pool of the redis resource, for commands the RedisStore
+// does not provide, e.g. scripts. The pool is created once per resource and shared with its RedisStore.
+func RdPool(resourceName string) *redis.Pool {
+	rdPoolMu.Lock()
+	defer rdPoolMu.Unlock()
+	if p := rdPool[resourceName]; p != nil {
+		return p
+	}
+	c := GetRedisResource(resourceName)
+	p := &redis.Pool{
+		MaxIdle:     5,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			conn, err := redis.Dial("tcp", c.Host, redis.DialConnectTimeout(10*time.Second))
+			if err != nil {
+				return nil, err
+			}
+			if c.Password != "" {
+				_, err = conn.Do("AUTH", c.Password)
+			} else {
+				_, err = conn.Do("PING")
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		},
+		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+			if time.Since(t) < 30*time.Second {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+	rdPool[resourceName] = p
+
+	return p
+}
+
+// CloseAll function closes every memcached connection and redis pool, the redis stores share the pools
+func CloseAll() error {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	var errs []error
+	for name, mc := range Mc {
+		if mc != nil && mc.Client != nil {
+			if err := mc.Client.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+		delete(Mc, name)
+	}
+	for name := range Rd {
+		delete(Rd, name)
+	}
+	rdPoolMu.Lock()
+	for name, p := range rdPool {
+		if err := p.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		delete(rdPool, name)
+	}
+	rdPoolMu.Unlock()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/jasacloud/go-libraries/health"
+)
+
+// registerMemcachedHealth function registers the readiness check of the memcached resource
+func registerMemcachedHealth(resourceName string) {
+	health.Register("memcached:"+resourceName, func(ctx context.Context) error {
+		storesMu.Lock()
+		mc := Mc[resourceName]
+		storesMu.Unlock()
+		if mc == nil || mc.Client == nil {
+			return errors.New("not connected")
+		}
+		return mc.Client.Ping()
+	})
+}
+
+// registerRedisHealth function registers the readiness check of the redis resource
+func registerRedisHealth(resourceName string) {
+	health.Register("redis:"+resourceName, func(ctx context.Context) error {
+		conn, err := RdPool(resourceName).GetContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Do("PING")
+		return err
+	})
+}
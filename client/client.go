@@ -15,9 +15,13 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"github.com/gin-gonic/gin"
 	"github.com/jasacloud/go-libraries/config"
+	"github.com/jasacloud/go-libraries/metrics"
+	"github.com/jasacloud/go-libraries/utils/tracing"
 	"io"
 	"io/ioutil"
 	"log"
@@ -47,8 +51,8 @@ type ResourceOptions struct {
 
 // HttpResource struct
 type HttpResource struct {
-	Name       string       `json:"name" bson:"name"`
-	Url        string       `json:"url" bson:"url"`
+	Name       string       `json:"name" bson:"name" validate:"required"`
+	Url        string       `json:"url" bson:"url" validate:"required"`
 	Uri        string       `json:"uri" bson:"uri"`
 	PreHeaders []Properties `json:"preHeaders" bson:"preHeaders"`
 	PreParams  []Properties `json:"preParams" bson:"preParams"`
@@ -59,12 +63,17 @@ type HttpServer struct {
 	HttpServer []HttpResource `json:"httpResources" bson:"httpResources"`
 }
 
+func init() {
+	config.RegisterResources("httpResources", HttpResource{})
+}
+
 // Http struct
 type Http struct {
 	Client       *http.Client
 	HttpResource HttpResource
 	Request      *http.Request
 	Err          error
+	ctx          context.Context
 }
 
 // Config type config
@@ -72,11 +81,9 @@ type Config config.Config
 
 // GetHttpResource function
 func GetHttpResource(name string) HttpResource {
-	c := config.GetConfig()
-	var httpConfig HttpServer
-	config.GetConf(c.ByteConfig, &httpConfig)
+	httpServer, _ := config.Resources[HttpResource]("httpResources")
 
-	return getHttpConf(httpConfig.HttpServer, name)
+	return getHttpConf(httpServer, name)
 }
 
 // Join method
@@ -107,10 +114,7 @@ func (h *Http) SetUri(uri string) {
 
 // LoadHttpResource function
 func LoadHttpResource(resourceName string, options ...*ResourceOptions) Http {
-	c := config.GetConfig()
-	var httpConfig HttpServer
-	config.GetConf(c.ByteConfig, &httpConfig)
-	httpServer := httpConfig.HttpServer
+	httpServer, _ := config.Resources[HttpResource]("httpResources")
 
 	var h Http
 
@@ -207,15 +211,62 @@ func (h *Http) SetBearerAuthorization(token string) {
 	}
 }
 
+// SetContext method binds the request to ctx, e.g. the request context of the handled request.
+// The request ID and trace context of ctx are forwarded in the request headers. A *gin.Context is
+// replaced by its request context, gin reuses the gin.Context once the request is handled.
+func (h *Http) SetContext(ctx context.Context) {
+	if c, ok := ctx.(*gin.Context); ok && c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	h.ctx = ctx
+	if h.Request != nil {
+		h.Request = h.Request.WithContext(ctx)
+	}
+}
+
+// injectTrace method sets the correlation headers of the bound context, headers set by the caller are kept
+func (h *Http) injectTrace() {
+	if h.Request == nil {
+		return
+	}
+	t, ok := tracing.FromContext(h.Request.Context())
+	if !ok {
+		return
+	}
+	headers := http.Header{}
+	t.Inject(headers)
+	for k := range headers {
+		if h.Request.Header.Get(k) == "" {
+			h.Request.Header.Set(k, headers.Get(k))
+		}
+	}
+}
+
+// send method sends the request and records its duration
+func (h *Http) send() (*http.Response, error) {
+	h.injectTrace()
+	start := time.Now()
+	resp, err := h.Client.Do(h.Request)
+	status := "error"
+	if err == nil {
+		status = metrics.StatusCode(resp.StatusCode)
+	}
+	metrics.HttpClientRequestDuration.
+		WithLabelValues(h.Request.Method, h.Request.URL.Host, status).
+		Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
+
 // Start method
 func (h *Http) Start() (*http.Response, error) {
-	return h.Client.Do(h.Request)
+	return h.send()
 }
 
 // Do method
 func (h *Http) Do(i interface{}) error {
 	h.SetClose(true)
-	resp, err := h.Client.Do(h.Request)
+	resp, err := h.send()
 	if err != nil {
 		log.Println("request error:", err)
 		log.Println("url:", h.Request.URL.String())
@@ -321,7 +372,11 @@ func (h *Http) SetRequest(method string, contentTyppe string, body io.Reader) {
 	if h.HttpResource.Uri != "" {
 		strUrl = strings.TrimSuffix(strUrl, "/") + "/" + strings.TrimPrefix(h.HttpResource.Uri, "/") + "?"
 	}
-	h.Request, h.Err = http.NewRequest(method, strUrl, body)
+	ctx := h.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	h.Request, h.Err = http.NewRequestWithContext(ctx, method, strUrl, body)
 	if h.Err != nil {
 		log.Println("client.Http.SetRequest() http.NewRequest init error:", method, strUrl)
 	}
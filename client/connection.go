@@ -27,7 +27,7 @@ import (
 
 // ConnectionResource struct
 type ConnectionResource struct {
-	Name         string `json:"name" bson:"name"`
+	Name         string `json:"name" bson:"name" validate:"required"`
 	HttpResource string `json:"HttpResource" bson:"HttpResource"`
 	Cid          string `json:"cid" bson:"cid"`
 	AuthResource string `json:"authResource" bson:"authResource"`
@@ -38,23 +38,20 @@ type ConnectionConf struct {
 	ConnectionResources []ConnectionResource `json:"connectionResources" bson:"connectionResources"`
 }
 
+func init() {
+	config.RegisterResources("connectionResources", ConnectionResource{})
+}
+
 var (
-	// Conn variable
+	// Conn variable is not updated anymore, use GetConnectionResource which reads the current config
 	Conn ConnectionConf
 )
 
 // GetConnectionResource function
 func GetConnectionResource(resourceName string) ConnectionResource {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Conn)
-	for _, v := range Conn.ConnectionResources {
-		if v.Name == resourceName {
-
-			return v
-		}
-	}
+	r, _ := config.Resource[ConnectionResource]("connectionResources", resourceName)
 
-	return ConnectionResource{}
+	return r
 }
 
 // Connect function
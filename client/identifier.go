@@ -19,9 +19,9 @@ import (
 
 // IdentifierResource struct
 type IdentifierResource struct {
-	Name       string `json:"name" bson:"name"`
+	Name       string `json:"name" bson:"name" validate:"required"`
 	Identifier string `json:"identifier" bson:"identifier"`
-	Password   string `json:"password" bson:"password"`
+	Password   string `json:"password" bson:"password" secret:"true"`
 }
 
 // IdentifierConf struct
@@ -29,21 +29,18 @@ type IdentifierConf struct {
 	IdentifierResources []IdentifierResource `json:"authResources" bson:"authResources"`
 }
 
+func init() {
+	config.RegisterResources("authResources", IdentifierResource{})
+}
+
 var (
-	// Identifier variable
+	// Identifier variable is not updated anymore, use GetIdentifierResource which reads the current config
 	Identifier IdentifierConf
 )
 
 // GetIdentifierResource function
 func GetIdentifierResource(resourceName string) IdentifierResource {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Identifier)
-	for _, v := range Identifier.IdentifierResources {
-		if v.Name == resourceName {
-
-			return v
-		}
-	}
+	r, _ := config.Resource[IdentifierResource]("authResources", resourceName)
 
-	return IdentifierResource{}
+	return r
 }
@@ -0,0 +1,156 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command jasaconfig produces encrypted config values and reviews effective configs.
+//
+//	jasaconfig encrypt [-master-key key] [value]
+//	jasaconfig decrypt [-master-key key] [enc:value]
+//	jasaconfig dump [-profile name] config.json
+//	jasaconfig diff [-profile name] old.json new.json
+//
+// The value is read from stdin when not given, the master key defaults to CONFIG_MASTER_KEY.
+// Dump and diff print the configs after includes and profile are applied, with every password, secret
+// and key field masked. Secret references and encrypted values are never resolved. Only the env overrides
+// of the log section, the one section registered in jasaconfig, are applied, the other JASA_ variables
+// are reported on stderr as not applied.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/jasacloud/go-libraries/config"
+	"os"
+	"strings"
+)
+
+// usage function
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: jasaconfig encrypt|decrypt [-master-key key] [value]")
+	fmt.Fprintln(os.Stderr, "       jasaconfig dump [-profile name] config.json")
+	fmt.Fprintln(os.Stderr, "       jasaconfig diff [-profile name] old.json new.json")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+	switch cmd {
+	case "encrypt", "decrypt":
+		os.Exit(crypt(cmd, os.Args[2:]))
+	case "dump":
+		os.Exit(dump(os.Args[2:]))
+	case "diff":
+		os.Exit(diff(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+// crypt function
+func crypt(cmd string, args []string) int {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	masterKey := fs.String("master-key", os.Getenv(config.MasterKeyEnv), "master key")
+	_ = fs.Parse(args)
+
+	value := strings.Join(fs.Args(), " ")
+	if fs.NArg() == 0 {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(os.Stderr, "failed read value from stdin:", err)
+			return 1
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+
+	var out string
+	var err error
+	if cmd == "encrypt" {
+		out, err = config.Encrypt(*masterKey, value)
+	} else {
+		out, err = config.Decrypt(*masterKey, value)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(out)
+
+	return 0
+}
+
+// loadFlags function parses the flags shared by dump and diff, returns the config files
+func loadFlags(cmd string, args []string) []string {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	fs.StringVar(&config.Profile, "profile", "", "config profile")
+	_ = fs.Parse(args)
+	for _, key := range config.UnmergedEnv(config.EnvPrefix) {
+		fmt.Fprintf(os.Stderr, "warning: env %s not applied, its section is not registered in jasaconfig\n", key)
+	}
+
+	return fs.Args()
+}
+
+// dump function
+func dump(args []string) int {
+	files := loadFlags("dump", args)
+	if len(files) != 1 {
+		usage()
+	}
+	l, err := config.NewLoader(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	b, err := l.Dump()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(b))
+
+	return 0
+}
+
+// diff function
+func diff(args []string) int {
+	files := loadFlags("diff", args)
+	if len(files) != 2 {
+		usage()
+	}
+	o, err := config.NewLoader(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	n, err := config.NewLoader(files[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	changes, err := config.Diff(o.Config.ByteConfig, n.Config.ByteConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+
+	return 0
+}
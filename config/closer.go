@@ -0,0 +1,57 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// closer struct
+type closer struct {
+	name  string
+	close func() error
+}
+
+var (
+	closersMu sync.Mutex
+	closers   []closer
+)
+
+// RegisterCloser function registers the function closing the connections of the resources kind,
+// e.g. RegisterCloser("nats", broker.CloseNats). Closers run on shutdown in reverse order.
+func RegisterCloser(name string, close func() error) {
+	closersMu.Lock()
+	defer closersMu.Unlock()
+	closers = append(closers, closer{name: name, close: close})
+}
+
+// CloseResources function runs every registered closer in reverse order of registration
+// and returns the errors of all failed closers
+func CloseResources() error {
+	closersMu.Lock()
+	cs := make([]closer, len(closers))
+	copy(cs, closers)
+	closersMu.Unlock()
+
+	var errs []error
+	for i := len(cs) - 1; i >= 0; i-- {
+		if err := cs[i].close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cs[i].name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -48,6 +48,8 @@ var Ver string
 type Config struct {
 	ConfigPath string
 	ByteConfig []byte
+	// Files are the config file, its includes and profile overlay
+	Files []string
 }
 
 // LoadConfig function
@@ -57,6 +59,10 @@ func LoadConfig(configPath string) {
 
 	configArg := flag.String("config", "", "config file")
 	logArg := flag.String("log", "", "log output file")
+	flag.StringVar(&Format, "format", "", "config file format: json, yaml or toml (default from file extension)")
+	flag.StringVar(&Profile, "profile", "", "config profile, loads config.<profile>.json on top of the config file (default from "+ProfileEnv+")")
+	flag.StringVar(&MasterKey, "master-key", "", "master key of enc: encrypted config values (default from "+MasterKeyEnv+")")
+	flag.Var(&Overrides, "set", "override config value by path, e.g. -set listen.listenPort=8080")
 	flag.Parse()
 
 	// handling config file :
@@ -93,12 +99,20 @@ func LoadConfig(configPath string) {
 	}
 	fmt.Println("CONFIG : ", configPath)
 
-	Properties = &Config{
-		configPath,
-		GetByteConf(configPath),
+	byteConfig, files, err := loadByteConfig(configPath)
+	if err != nil {
+		log.Panic("failed load config in "+configPath+", error: ", err)
+	}
+	if err := Validate(byteConfig); err != nil {
+		log.Panic("failed validate config in "+configPath+", error: ", err)
 	}
+	setProperties(&Config{
+		ConfigPath: configPath,
+		ByteConfig: byteConfig,
+		Files:      files,
+	})
 	var Log logger.LogConfig
-	GetConf(Properties.ByteConfig, &Log)
+	GetConf(GetConfig().ByteConfig, &Log)
 
 	if runtime.GOOS == "windows" {
 		Log.Properties.Output = path.Join(GetConfigDir(), Log.Properties.Output)
@@ -244,18 +258,14 @@ func GetConf(byteConfig []byte, nodeConfig interface{}) {
 	if err := json.Unmarshal(byteConfig, nodeConfig); err != nil {
 		log.Fatal(err)
 	}
+	if err := ResolveSecretFields(nodeConfig); err != nil {
+		log.Println("failed resolve config secrets, error: ", err)
+	}
 }
 
-// GetByteConf function
+// GetByteConf function reads the config file and returns it as JSON, YAML and TOML files are converted
 func GetByteConf(configPath string) []byte {
-	jsonFile, err := os.Open(configPath)
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer jsonFile.Close()
-
-	byteValue, err := ioutil.ReadAll(jsonFile)
-
+	byteValue, err := readByteConf(configPath)
 	if err != nil {
 		fmt.Println("Error load config : ", err)
 	}
@@ -263,8 +273,17 @@ func GetByteConf(configPath string) []byte {
 	return byteValue
 }
 
+// readByteConf function reads the config file with its includes and profile overlay
+func readByteConf(configPath string) ([]byte, error) {
+	byteValue, _, err := readProfile(configPath)
+
+	return byteValue, err
+}
+
 // GetConfig function
 func GetConfig() *Config {
+	propertiesMu.RLock()
+	defer propertiesMu.RUnlock()
 
 	return Properties
 }
@@ -312,7 +331,7 @@ func GetProcessDir() string {
 
 // GetConfigDir function
 func GetConfigDir() string {
-	configDir, err := filepath.Abs(filepath.Dir(Properties.ConfigPath))
+	configDir, err := filepath.Abs(filepath.Dir(GetConfig().ConfigPath))
 	if err != nil {
 		log.Println("failed read process path, error: ", err)
 	}
@@ -0,0 +1,82 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"github.com/jasacloud/go-libraries/system"
+	"os"
+	"strings"
+)
+
+const (
+	// EncryptedPrefix constant marks an encrypted config value, e.g. "enc:<ciphertext>"
+	EncryptedPrefix string = "enc:"
+	// MasterKeyEnv constant is the environment variable of the master key
+	MasterKeyEnv string = "CONFIG_MASTER_KEY"
+)
+
+// MasterKey variable is the key of encrypted values, from -master-key flag or CONFIG_MASTER_KEY env
+var MasterKey string
+
+// ErrMasterKeyNotDefined is returned when an encrypted value is found without a master key
+var ErrMasterKeyNotDefined = errors.New("master key not defined, use -master-key or " + MasterKeyEnv)
+
+// Encrypt function encrypts plain with the master key using AES-GCM and returns it as "enc:<ciphertext>"
+func Encrypt(masterKey, plain string) (string, error) {
+	if masterKey == "" {
+		return "", ErrMasterKeyNotDefined
+	}
+	c, err := system.EncryptAesGcm(aesKey(masterKey), plain)
+	if err != nil {
+		return "", err
+	}
+
+	return EncryptedPrefix + c, nil
+}
+
+// Decrypt function decrypts the "enc:<ciphertext>" value with the master key, a modified ciphertext fails
+func Decrypt(masterKey, value string) (string, error) {
+	if masterKey == "" {
+		return "", ErrMasterKeyNotDefined
+	}
+	plain, err := system.DecryptAesGcm(aesKey(masterKey), strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", errors.New("failed decrypt value, wrong master key or modified value")
+	}
+
+	return plain, nil
+}
+
+// IsEncrypted function
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+// getMasterKey function
+func getMasterKey() string {
+	if MasterKey != "" {
+		return MasterKey
+	}
+
+	return os.Getenv(MasterKeyEnv)
+}
+
+// aesKey function derives the AES-256 key from the master key
+func aesKey(masterKey string) []byte {
+	k := sha256.Sum256([]byte(masterKey))
+
+	return k[:]
+}
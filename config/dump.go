@@ -0,0 +1,251 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jasacloud/go-libraries/utils/masker"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SensitiveKeys variable lists the key fragments of config fields that are masked by Dump and Diff
+var SensitiveKeys = []string{"password", "passwd", "pwd", "secret", "token", "key"}
+
+// Change struct is a difference between two config documents
+type Change struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// String method
+func (c Change) String() string {
+	switch c.Type {
+	case "added":
+		return fmt.Sprintf("+ %s: %s", c.Path, dumpValue(c.New))
+	case "removed":
+		return fmt.Sprintf("- %s: %s", c.Path, dumpValue(c.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", c.Path, dumpValue(c.Old), dumpValue(c.New))
+	}
+}
+
+// Dump function returns the current effective config as indented JSON with its secrets masked
+func Dump() ([]byte, error) {
+	l, err := CurrentLoader()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Dump()
+}
+
+// Dump method returns the loader config as indented JSON with its secrets masked
+func (l *Loader) Dump() ([]byte, error) {
+	if l.Config == nil {
+		return nil, ErrConfigNotLoaded
+	}
+
+	return MaskDocument(l.Config.ByteConfig)
+}
+
+// MaskDocument function masks every password, secret and key field of the config document
+func MaskDocument(byteConfig []byte) ([]byte, error) {
+	doc, err := decodeDocument(byteConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(maskNode("", doc)); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// Diff function compares two config documents, named resources are compared by their name.
+// Values of sensitive fields are masked in the returned changes.
+func Diff(oldConfig, newConfig []byte) ([]Change, error) {
+	o, err := decodeDocument(oldConfig)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeDocument(newConfig)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffNode("", "", o, n, &changes)
+
+	return changes, nil
+}
+
+// decodeDocument function
+func decodeDocument(b []byte) (interface{}, error) {
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return doc, nil
+}
+
+// isSensitive function
+func isSensitive(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range SensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskNode function returns a masked copy of node, key is the field name holding node
+func maskNode(key string, node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			m[k] = maskNode(k, v)
+		}
+		// name/value pairs, e.g. preParams: [{"name":"authpwd","value":"..."}]
+		if name, ok := n["name"].(string); ok && isSensitive(name) {
+			if v, ok := n["value"]; ok {
+				m["value"] = maskNode(name, v)
+			}
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(n))
+		for i, v := range n {
+			a[i] = maskNode(key, v)
+		}
+		return a
+	case string:
+		if isSensitive(key) {
+			return masker.Password(n)
+		}
+		if strings.Contains(n, "://") && strings.Contains(n, "@") {
+			return masker.UriPassword(n)
+		}
+		return n
+	default:
+		return n
+	}
+}
+
+// diffNode function
+func diffNode(path, key string, o, n interface{}, changes *[]Change) {
+	om, oOk := o.(map[string]interface{})
+	nm, nOk := n.(map[string]interface{})
+	if oOk && nOk {
+		keys := make([]string, 0, len(om)+len(nm))
+		for k := range om {
+			keys = append(keys, k)
+		}
+		for k := range nm {
+			if _, ok := om[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			ck := k
+			if name, ok := nm["name"].(string); ok && k == "value" && isSensitive(name) {
+				ck = name
+			}
+			ov, inOld := om[k]
+			nv, inNew := nm[k]
+			switch {
+			case !inOld:
+				*changes = append(*changes, Change{Path: p, Type: "added", New: maskNode(ck, nv)})
+			case !inNew:
+				*changes = append(*changes, Change{Path: p, Type: "removed", Old: maskNode(ck, ov)})
+			default:
+				diffNode(p, ck, ov, nv, changes)
+			}
+		}
+		return
+	}
+
+	oa, oOk := o.([]interface{})
+	na, nOk := n.([]interface{})
+	if oOk && nOk && namedResources(oa) && namedResources(na) {
+		names := make([]string, 0, len(oa)+len(na))
+		byName := func(arr []interface{}) map[string]interface{} {
+			m := make(map[string]interface{}, len(arr))
+			for _, v := range arr {
+				name := v.(map[string]interface{})["name"].(string)
+				if _, ok := m[name]; !ok {
+					m[name] = v
+					names = append(names, name)
+				}
+			}
+			return m
+		}
+		om, nm := byName(oa), byName(na)
+		seen := make(map[string]bool)
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			p := fmt.Sprintf("%s[%s]", path, name)
+			ov, inOld := om[name]
+			nv, inNew := nm[name]
+			switch {
+			case !inOld:
+				*changes = append(*changes, Change{Path: p, Type: "added", New: maskNode(key, nv)})
+			case !inNew:
+				*changes = append(*changes, Change{Path: p, Type: "removed", Old: maskNode(key, ov)})
+			default:
+				diffNode(p, key, ov, nv, changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(o, n) {
+		*changes = append(*changes, Change{Path: path, Type: "changed", Old: maskNode(key, o), New: maskNode(key, n)})
+	}
+}
+
+// dumpValue function
+func dumpValue(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return strings.TrimRight(buf.String(), "\n")
+}
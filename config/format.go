@@ -0,0 +1,98 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// FormatJSON constant
+	FormatJSON string = "json"
+	// FormatYAML constant
+	FormatYAML string = "yaml"
+	// FormatTOML constant
+	FormatTOML string = "toml"
+)
+
+// Format variable forces the config file format, detected from file extension when empty
+var Format string
+
+// DetectFormat function returns the config format of configPath based on its extension
+func DetectFormat(configPath string) string {
+	if Format != "" {
+		return strings.ToLower(Format)
+	}
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// ToJSON function normalise the config content of the format into JSON
+func ToJSON(b []byte, format string) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case FormatJSON, "":
+		return b, nil
+	case FormatYAML, "yml":
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", format)
+	}
+	if doc == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(normalise(doc))
+}
+
+// normalise function converts YAML maps with non-string keys so the document can be encoded as JSON
+func normalise(i interface{}) interface{} {
+	switch v := i.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalise(val)
+		}
+		return m
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = normalise(val)
+		}
+		return v
+	case []interface{}:
+		for k, val := range v {
+			v[k] = normalise(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
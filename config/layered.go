@@ -0,0 +1,310 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is prefix of environment variables that override config values,
+// e.g. JASA_DBRESOURCES_0_PASSWORD overrides dbResources[0].password
+var EnvPrefix = "JASA"
+
+// Overrides variable holds the command-line overrides given by -set path=value
+var Overrides OverrideFlag
+
+// OverrideFlag type is a repeatable flag of path=value config overrides
+type OverrideFlag []string
+
+// String method
+func (o *OverrideFlag) String() string {
+	return strings.Join(*o, ",")
+}
+
+// Set method
+func (o *OverrideFlag) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("invalid override %q, expected path=value", value)
+	}
+	*o = append(*o, value)
+	return nil
+}
+
+// MergeLayers function merge the config file content with the environment variables
+// having envPrefix and the path=value overrides, in that order of precedence.
+// Path segments are separated by dot, array elements are selected by index or by name.
+// Only the environment variables of a registered section are merged. A value replacing a string
+// or set where the config has no value is kept as string, unless the registered field is not a string.
+func MergeLayers(byteConfig []byte, envPrefix string, overrides []string) ([]byte, error) {
+	var doc interface{} = map[string]interface{}{}
+	if len(bytes.TrimSpace(byteConfig)) > 0 {
+		d := json.NewDecoder(bytes.NewReader(byteConfig))
+		d.UseNumber()
+		if err := d.Decode(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if envPrefix != "" {
+		prefix := strings.ToUpper(envPrefix) + "_"
+		for _, env := range os.Environ() {
+			key, value, _ := strings.Cut(env, "=")
+			if !strings.HasPrefix(strings.ToUpper(key), prefix) || len(key) == len(prefix) {
+				continue
+			}
+			path := strings.Split(key[len(prefix):], "_")
+			if !registered(path[0]) {
+				continue
+			}
+			doc, err = setPath(doc, path, value, pathType(path))
+			if err != nil {
+				return nil, fmt.Errorf("env %s: %v", key, err)
+			}
+		}
+	}
+
+	for _, o := range overrides {
+		key, value, _ := strings.Cut(o, "=")
+		path := strings.Split(key, ".")
+		doc, err = setPath(doc, path, value, pathType(path))
+		if err != nil {
+			return nil, fmt.Errorf("override %s: %v", key, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// UnmergedEnv function returns the names of the environment variables having envPrefix that MergeLayers
+// skips because their section is not registered, e.g. by a binary not importing the package of the section
+func UnmergedEnv(envPrefix string) []string {
+	var keys []string
+	prefix := strings.ToUpper(envPrefix) + "_"
+	for _, env := range os.Environ() {
+		key, _, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(strings.ToUpper(key), prefix) || len(key) == len(prefix) {
+			continue
+		}
+		if section, _, _ := strings.Cut(key[len(prefix):], "_"); !registered(section) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// buildByteConfig function applies the override layers, the secret references are kept and
+// resolved when the sections are decoded
+func buildByteConfig(byteConfig []byte) ([]byte, error) {
+	return MergeLayers(byteConfig, EnvPrefix, Overrides)
+}
+
+// setPath function, typ is the registered type of the value at the path, nil when unknown
+func setPath(node interface{}, path []string, value string, typ reflect.Type) (interface{}, error) {
+	if len(path) == 0 {
+		return parseValue(node, value, typ), nil
+	}
+	seg := path[0]
+	if seg == "" {
+		return nil, fmt.Errorf("empty path segment")
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		key := seg
+		if _, ok := n[key]; !ok {
+			for k := range n {
+				if strings.EqualFold(k, seg) {
+					key = k
+					break
+				}
+			}
+		}
+		v, err := setPath(n[key], path[1:], value, typ)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = v
+
+		return n, nil
+	case []interface{}:
+		i, err := strconv.Atoi(seg)
+		if err != nil {
+			i = indexByName(n, seg)
+			if i < 0 {
+				return nil, fmt.Errorf("resource %q not found", seg)
+			}
+		}
+		if i == len(n) {
+			n = append(n, nil)
+		}
+		if i < 0 || i >= len(n) {
+			return nil, fmt.Errorf("index %d out of range", i)
+		}
+		v, err := setPath(n[i], path[1:], value, typ)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = v
+
+		return n, nil
+	case nil:
+		if _, err := strconv.Atoi(seg); err == nil {
+			return setPath([]interface{}{}, path, value, typ)
+		}
+		return setPath(map[string]interface{}{}, path, value, typ)
+	default:
+		return nil, fmt.Errorf("cannot set %q on a scalar value", seg)
+	}
+}
+
+// indexByName function returns index of array element that has the name, or -1
+func indexByName(arr []interface{}, name string) int {
+	for i, v := range arr {
+		if m, ok := v.(map[string]interface{}); ok {
+			if s, ok := m["name"].(string); ok && strings.EqualFold(s, name) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// parseValue function keeps value as string when it replaces a string or when it is set where the config
+// has no value and the registered type is unknown or a string, e.g. a numeric password.
+// Otherwise it tries to decode it as JSON.
+func parseValue(old interface{}, value string, typ reflect.Type) interface{} {
+	if _, ok := old.(string); ok {
+		return value
+	}
+	if old == nil {
+		for typ != nil && typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ == nil || typ.Kind() == reflect.String || typ.Kind() == reflect.Interface {
+			return value
+		}
+	}
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil || d.More() {
+		return value
+	}
+
+	return v
+}
+
+// registered function reports whether name is a registered section, case-insensitively
+func registered(name string) bool {
+	return registeredSchema(name) != nil
+}
+
+// registeredSchema function
+func registeredSchema(name string) *schema {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	if s, ok := schemas[name]; ok {
+		return s
+	}
+	for k, s := range schemas {
+		if strings.EqualFold(k, name) {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// pathType function returns the type of the field at the path of a registered section, nil when unknown
+func pathType(path []string) reflect.Type {
+	s := registeredSchema(path[0])
+	if s == nil {
+		return nil
+	}
+	rest := path[1:]
+	if s.resources {
+		if len(rest) == 0 {
+			return reflect.SliceOf(s.types[0])
+		}
+		// the resource index or name
+		rest = rest[1:]
+	}
+	for _, t := range s.types {
+		if ft := fieldType(t, rest); ft != nil {
+			return ft
+		}
+	}
+
+	return nil
+}
+
+// fieldType function returns the type at the path of json field names in t, nil when there is none
+func fieldType(t reflect.Type, path []string) reflect.Type {
+	for _, seg := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := jsonField(t, seg)
+			if !ok {
+				return nil
+			}
+			t = f
+		case reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return nil
+		}
+	}
+
+	return t
+}
+
+// jsonField function returns the type of the field of struct type t having the json name, case-insensitively
+func jsonField(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if ft, ok := jsonField(f.Type, name); ok {
+				return ft, true
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f.Type, true
+		}
+	}
+
+	return nil, false
+}
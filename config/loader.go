@@ -0,0 +1,157 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrConfigNotLoaded is returned when no config has been loaded yet
+	ErrConfigNotLoaded = errors.New("config not loaded")
+	// ErrInvalidConfig is returned when the config document or a section of it can not be decoded
+	ErrInvalidConfig = errors.New("invalid config")
+	// ErrResourceNotFound is returned when a named resource is not defined in its section
+	ErrResourceNotFound = errors.New("resource not found")
+)
+
+// Loader type is the error returning counterpart of LoadConfig and GetConf
+type Loader struct {
+	Config *Config
+}
+
+// NewLoader function reads the config file merged with the env and -set overrides,
+// unlike LoadConfig it does not parse flags, panic or change the current config
+func NewLoader(configPath string) (*Loader, error) {
+	if configPath == "" {
+		return nil, fmt.Errorf("%w: config path not defined", ErrInvalidConfig)
+	}
+	byteConfig, files, err := loadByteConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, configPath, err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(byteConfig, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, configPath, err)
+	}
+
+	return &Loader{
+		Config: &Config{
+			ConfigPath: configPath,
+			ByteConfig: byteConfig,
+			Files:      files,
+		},
+	}, nil
+}
+
+// CurrentLoader function returns a Loader of the current config
+func CurrentLoader() (*Loader, error) {
+	c := GetConfig()
+	if c == nil {
+		return nil, ErrConfigNotLoaded
+	}
+
+	return &Loader{Config: c}, nil
+}
+
+// Use method sets the loader config as the current config
+func (l *Loader) Use() {
+	setProperties(l.Config)
+}
+
+// GetConf method decodes the whole config document into nodeConfig
+func (l *Loader) GetConf(nodeConfig interface{}) error {
+	if l.Config == nil {
+		return ErrConfigNotLoaded
+	}
+	if err := json.Unmarshal(l.Config.ByteConfig, nodeConfig); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return ResolveSecretFields(nodeConfig)
+}
+
+// GetSection method decodes a top level section, e.g. "listen" or "cors", into section
+func (l *Loader) GetSection(name string, section interface{}) error {
+	raw, err := l.section(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, section); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
+	}
+	if err := ResolveSecretFields(section); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// GetResource method finds the resource having name in the resources section,
+// e.g. "mailResources", and decodes it into resource
+func (l *Loader) GetResource(section, name string, resource interface{}) error {
+	raw, err := l.section(section)
+	if err != nil {
+		return err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, section, err)
+	}
+	for i, item := range items {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(item, &named); err != nil {
+			return fmt.Errorf("%w: %s[%d]: %v", ErrInvalidConfig, section, i, err)
+		}
+		if named.Name != name {
+			continue
+		}
+		if err := json.Unmarshal(item, resource); err != nil {
+			return fmt.Errorf("%w: %s[%d]: %v", ErrInvalidConfig, section, i, err)
+		}
+		if err := ResolveSecretFields(resource); err != nil {
+			return fmt.Errorf("%s[%d]: %w", section, i, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s %q", ErrResourceNotFound, section, name)
+}
+
+// section method returns the raw top level section, keys are matched case-insensitively like encoding/json
+func (l *Loader) section(name string) (json.RawMessage, error) {
+	if l.Config == nil {
+		return nil, ErrConfigNotLoaded
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(l.Config.ByteConfig, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if raw, ok := doc[name]; ok {
+		return raw, nil
+	}
+	for k, raw := range doc {
+		if strings.EqualFold(k, name) {
+			return raw, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: section %s is not defined", ErrResourceNotFound, name)
+}
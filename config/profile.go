@@ -0,0 +1,194 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ProfileEnv constant is the environment variable of the config profile
+	ProfileEnv string = "CONFIG_PROFILE"
+	// IncludeKey constant is the top level key listing the files included by a config file
+	IncludeKey string = "include"
+)
+
+// Profile variable selects the config.<profile>.json overlay, from -profile flag or CONFIG_PROFILE env
+var Profile string
+
+// getProfile function
+func getProfile() string {
+	if Profile != "" {
+		return Profile
+	}
+
+	return os.Getenv(ProfileEnv)
+}
+
+// ProfilePath function returns the overlay file of the profile, e.g. config.prod.json for config.json.
+// A config file without extension, like the default config, takes the extension of its format,
+// e.g. config.prod.json for config or config.prod.yaml for config -format yaml.
+func ProfilePath(configPath, profile string) string {
+	ext := filepath.Ext(configPath)
+	base := strings.TrimSuffix(configPath, ext)
+	if ext == "" {
+		ext = "." + DetectFormat(configPath)
+	}
+
+	return base + "." + profile + ext
+}
+
+// readProfile function reads the config file and its includes, then merges the profile overlay on top.
+// It returns the merged document as JSON and every file that was read.
+func readProfile(configPath string) ([]byte, []string, error) {
+	var files []string
+	doc, err := readDocument(configPath, map[string]bool{}, &files)
+	if err != nil {
+		return nil, files, err
+	}
+	if profile := getProfile(); profile != "" {
+		overlay, err := readDocument(ProfilePath(configPath, profile), map[string]bool{}, &files)
+		if err != nil {
+			return nil, files, fmt.Errorf("profile %s: %v", profile, err)
+		}
+		doc = MergeDocument(doc, overlay)
+	}
+	b, err := json.Marshal(doc)
+
+	return b, files, err
+}
+
+// readDocument function reads a config file of any supported format and resolves its include directive.
+// Included files are merged first so the including file overrides them.
+func readDocument(file string, seen map[string]bool, files *[]string) (interface{}, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	if seen[abs] {
+		return nil, fmt.Errorf("include cycle on %s", file)
+	}
+	seen[abs] = true
+	defer delete(seen, abs)
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	*files = append(*files, file)
+	if len(bytes.TrimSpace(b)) == 0 {
+		return nil, fmt.Errorf("config file %s is empty", file)
+	}
+	b, err = ToJSON(b, DetectFormat(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok || m[IncludeKey] == nil {
+		return doc, nil
+	}
+
+	var includes []string
+	switch v := m[IncludeKey].(type) {
+	case string:
+		includes = append(includes, v)
+	case []interface{}:
+		for _, i := range v {
+			s, ok := i.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a list of file names", file, IncludeKey)
+			}
+			includes = append(includes, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %s must be a list of file names", file, IncludeKey)
+	}
+	delete(m, IncludeKey)
+
+	var base interface{} = map[string]interface{}{}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(file), inc)
+		}
+		d, err := readDocument(inc, seen, files)
+		if err != nil {
+			return nil, err
+		}
+		base = MergeDocument(base, d)
+	}
+
+	return MergeDocument(base, m), nil
+}
+
+// MergeDocument function merges src on top of dst. Objects are merged recursively,
+// arrays of named resources are merged by name and any other value of src replaces dst.
+func MergeDocument(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return s
+		}
+		for k, v := range s {
+			d[k] = MergeDocument(d[k], v)
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok || !namedResources(d) || !namedResources(s) {
+			return s
+		}
+	next:
+		for _, v := range s {
+			name := v.(map[string]interface{})["name"]
+			for i := range d {
+				if d[i].(map[string]interface{})["name"] == name {
+					d[i] = MergeDocument(d[i], v)
+					continue next
+				}
+			}
+			d = append(d, v)
+		}
+		return d
+	default:
+		return src
+	}
+}
+
+// namedResources function reports whether every element of arr is an object with a name
+func namedResources(arr []interface{}) bool {
+	for _, v := range arr {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+
+	return true
+}
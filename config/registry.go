@@ -0,0 +1,169 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// registryKey struct
+type registryKey struct {
+	kind    string
+	section string
+	typ     reflect.Type
+}
+
+// registryEntry struct holds a decoded resources section
+type registryEntry[T any] struct {
+	items []T
+	names map[string]int
+	// errs holds the secrets of the items that could not be resolved
+	errs []error
+}
+
+var (
+	registryMu     sync.RWMutex
+	registryConfig *Config
+	registry       = make(map[registryKey]interface{})
+)
+
+// Resource function returns the resource having name from the resources section of the current config,
+// e.g. Resource[server.JwtOption]("jwtResources", "default"). The section is decoded once per loaded
+// config and cached, a reload invalidates the cache.
+func Resource[T any](section, name string) (T, error) {
+	var zero T
+	e, err := cached("resources", section, buildResources[T])
+	if err != nil {
+		return zero, err
+	}
+	i, ok := e.names[name]
+	if !ok {
+		return zero, fmt.Errorf("%w: %s %q", ErrResourceNotFound, section, name)
+	}
+	if e.errs[i] != nil {
+		return e.items[i], e.errs[i]
+	}
+
+	return e.items[i], nil
+}
+
+// Resources function returns every resource of the resources section of the current config.
+// The returned slice is shared by the cache and must not be modified. The secrets that could not
+// be resolved are reported by the joined error, the other resources are returned with it.
+func Resources[T any](section string) ([]T, error) {
+	e, err := cached("resources", section, buildResources[T])
+	if err != nil {
+		return nil, err
+	}
+
+	return e.items, errors.Join(e.errs...)
+}
+
+// Section function returns the top level section of the current config, e.g. Section[server.Listen]("listen")
+func Section[T any](name string) (T, error) {
+	var zero T
+	e, err := cached("section", name, func(l *Loader, name string) (*registryEntry[T], error) {
+		var v T
+		if err := l.GetSection(name, &v); err != nil {
+			return nil, err
+		}
+		return &registryEntry[T]{items: []T{v}}, nil
+	})
+	if err != nil {
+		return zero, err
+	}
+
+	return e.items[0], nil
+}
+
+// buildResources function decodes the resources section, the first resource of a name wins
+func buildResources[T any](l *Loader, section string) (*registryEntry[T], error) {
+	raw, err := l.section(section)
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, section, err)
+	}
+	e := &registryEntry[T]{
+		items: make([]T, len(items)),
+		names: make(map[string]int, len(items)),
+		errs:  make([]error, len(items)),
+	}
+	for i, item := range items {
+		var named struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(item, &named); err != nil {
+			return nil, fmt.Errorf("%w: %s[%d]: %v", ErrInvalidConfig, section, i, err)
+		}
+		if err := json.Unmarshal(item, &e.items[i]); err != nil {
+			return nil, fmt.Errorf("%w: %s[%d]: %v", ErrInvalidConfig, section, i, err)
+		}
+		if err := ResolveSecretFields(&e.items[i]); err != nil {
+			e.errs[i] = fmt.Errorf("%s[%d]: %w", section, i, err)
+		}
+		if _, ok := e.names[named.Name]; !ok {
+			e.names[named.Name] = i
+		}
+	}
+
+	return e, nil
+}
+
+// cached function returns the entry of the section from the registry or builds it from the current config
+func cached[T any](kind, section string, build func(l *Loader, section string) (*registryEntry[T], error)) (*registryEntry[T], error) {
+	c := GetConfig()
+	if c == nil {
+		return nil, ErrConfigNotLoaded
+	}
+	key := registryKey{
+		kind:    kind,
+		section: section,
+		typ:     reflect.TypeOf((*registryEntry[T])(nil)),
+	}
+
+	registryMu.RLock()
+	if registryConfig == c {
+		if e, ok := registry[key]; ok {
+			registryMu.RUnlock()
+			return e.(*registryEntry[T]), nil
+		}
+	}
+	registryMu.RUnlock()
+
+	e, err := build(&Loader{Config: c}, section)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if GetConfig() != c {
+		// reloaded meanwhile, do not cache the entry of the previous config
+		return e, nil
+	}
+	if registryConfig != c {
+		registryConfig = c
+		registry = make(map[registryKey]interface{})
+	}
+	registry[key] = e
+
+	return e, nil
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/jasacloud/go-libraries/helper"
+	"github.com/jasacloud/go-libraries/logger"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// schema struct
+type schema struct {
+	types     []reflect.Type
+	resources bool
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = make(map[string]*schema)
+	// strict makes unknown fields validation problems
+	strict atomic.Bool
+)
+
+// Problem struct is a single validation problem at a JSON path of the config
+type Problem struct {
+	Path    string
+	Message string
+}
+
+// ValidationError struct holds every problem found by Validate
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error method
+func (e *ValidationError) Error() string {
+	s := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		s = append(s, p.Path+": "+p.Message)
+	}
+
+	return "invalid config: " + strings.Join(s, "; ")
+}
+
+// Is method makes errors.Is(err, ErrInvalidConfig) true
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+func init() {
+	RegisterSection("log", logger.LogProperties{})
+	AddValidator(Validate)
+}
+
+// RegisterSection function registers the struct of a top level section, e.g. "listen", to be validated
+func RegisterSection(name string, section interface{}) {
+	register(name, section, false)
+}
+
+// RegisterResources function registers the struct of the items of a named resources section,
+// e.g. "dbResources", to be validated. A section may be registered by several packages.
+func RegisterResources(name string, resource interface{}) {
+	register(name, resource, true)
+}
+
+// SetStrict function makes unknown fields of registered sections validation problems that fail the load.
+// By default they are only logged as warnings.
+func SetStrict(enabled bool) {
+	strict.Store(enabled)
+}
+
+// register function
+func register(name string, i interface{}, resources bool) {
+	t := reflect.TypeOf(i)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	s := schemas[name]
+	if s == nil {
+		s = &schema{resources: resources}
+		schemas[name] = s
+	}
+	for _, v := range s.types {
+		if v == t {
+			return
+		}
+	}
+	s.types = append(s.types, t)
+}
+
+// Validate function checks every registered section present in the config document against its struct
+// and reports all problems at once. Sections that are not registered are ignored, unknown fields of
+// registered sections are logged as warnings unless SetStrict is enabled.
+func Validate(byteConfig []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(byteConfig, &doc); err != nil {
+		return &ValidationError{Problems: []Problem{{Path: "$", Message: err.Error()}}}
+	}
+
+	schemasMu.RLock()
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	schemasMu.RUnlock()
+	sort.Strings(names)
+
+	var problems []Problem
+	for _, name := range names {
+		raw, key := lookup(doc, name)
+		if raw == nil {
+			continue
+		}
+		schemasMu.RLock()
+		s := schemas[name]
+		schemasMu.RUnlock()
+		if !s.resources {
+			problems = append(problems, validateItem(key, raw, s.types)...)
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			problems = append(problems, Problem{Path: key, Message: "must be an array of resources"})
+			continue
+		}
+		seen := make(map[string]bool)
+		for i, item := range items {
+			path := fmt.Sprintf("%s[%d]", key, i)
+			problems = append(problems, validateItem(path, item, s.types)...)
+			var named struct {
+				Name string `json:"name"`
+			}
+			if json.Unmarshal(item, &named) == nil && named.Name != "" {
+				if seen[named.Name] {
+					problems = append(problems, Problem{Path: path + ".name", Message: fmt.Sprintf("duplicate resource name %q", named.Name)})
+				}
+				seen[named.Name] = true
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// Validate method checks the loader config, see Validate function
+func (l *Loader) Validate() error {
+	if l.Config == nil {
+		return ErrConfigNotLoaded
+	}
+
+	return Validate(l.Config.ByteConfig)
+}
+
+// lookup function finds the section by name, case-insensitively like encoding/json
+func lookup(doc map[string]json.RawMessage, name string) (json.RawMessage, string) {
+	if raw, ok := doc[name]; ok {
+		return raw, name
+	}
+	for k, raw := range doc {
+		if strings.EqualFold(k, name) {
+			return raw, k
+		}
+	}
+
+	return nil, ""
+}
+
+// validateItem function validates a JSON object against the struct types registered for it
+func validateItem(path string, raw json.RawMessage, types []reflect.Type) []Problem {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return []Problem{{Path: path, Message: "must be an object"}}
+	}
+
+	var problems []Problem
+	known := make(map[string]bool)
+	for _, t := range types {
+		for _, name := range jsonFields(t) {
+			known[strings.ToLower(name)] = true
+		}
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if known[strings.ToLower(k)] {
+			continue
+		}
+		if strict.Load() {
+			problems = append(problems, Problem{Path: path + "." + k, Message: "unknown field"})
+			continue
+		}
+		log.Println("config warning: " + path + "." + k + ": unknown field")
+	}
+
+	for _, t := range types {
+		v := reflect.New(t)
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			var te *json.UnmarshalTypeError
+			if errors.As(err, &te) && te.Field != "" {
+				problems = append(problems, Problem{Path: path + "." + te.Field, Message: "must be " + te.Type.String()})
+				continue
+			}
+			problems = append(problems, Problem{Path: path, Message: err.Error()})
+			continue
+		}
+		err := helper.ValidateStructJSON(v.Interface())
+		var ve validator.ValidationErrors
+		if !errors.As(err, &ve) {
+			continue
+		}
+		for _, fe := range ve {
+			ns := fe.Namespace()
+			if i := strings.Index(ns, "."); i >= 0 {
+				ns = ns[i+1:]
+			}
+			msg := "failed on '" + fe.Tag() + "' validation"
+			if fe.Param() != "" {
+				msg = "failed on '" + fe.Tag() + "=" + fe.Param() + "' validation"
+			}
+			problems = append(problems, Problem{Path: path + "." + ns, Message: msg})
+		}
+	}
+
+	return uniqueProblems(problems)
+}
+
+// jsonFields function returns the json names of the fields of struct type t
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFields(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// uniqueProblems function removes the same problem reported by several struct types of a section
+func uniqueProblems(problems []Problem) []Problem {
+	seen := make(map[Problem]bool)
+	unique := problems[:0]
+	for _, p := range problems {
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+
+	return unique
+}
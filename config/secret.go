@@ -0,0 +1,177 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SecretProvider resolves the secret references of its scheme, e.g. "env://DB_PASS". References are only
+// resolved in the fields tagged `secret:"true"` when a section or resource is decoded, see ResolveSecretFields.
+// Resolve receives the reference without the scheme, e.g. "DB_PASS".
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc type is an adapter to use a function as SecretProvider
+type SecretProviderFunc func(ref string) (string, error)
+
+// Resolve method
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// MapSecretProvider type resolves references from a static map, useful for tests and local runs
+type MapSecretProvider map[string]string
+
+// Resolve method
+func (m MapSecretProvider) Resolve(ref string) (string, error) {
+	if v, ok := m[ref]; ok {
+		return v, nil
+	}
+
+	return "", fmt.Errorf("secret %q not found", ref)
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{
+		"env":  SecretProviderFunc(envSecret),
+		"file": SecretProviderFunc(fileSecret),
+	}
+)
+
+// RegisterSecretProvider function registers the provider of the scheme, replacing the existing one
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[strings.ToLower(scheme)] = provider
+}
+
+// ResolveSecret function resolves value when it is a reference of a registered scheme
+// or an "enc:" encrypted value, other values are returned unchanged
+func ResolveSecret(value string) (string, error) {
+	if IsEncrypted(value) {
+		return Decrypt(getMasterKey(), value)
+	}
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	secretProvidersMu.RLock()
+	provider := secretProviders[strings.ToLower(scheme)]
+	secretProvidersMu.RUnlock()
+	if provider == nil {
+		return value, nil
+	}
+
+	return provider.Resolve(ref)
+}
+
+// ResolveSecretFields function resolves, in place, the string fields of v tagged `secret:"true"`, e.g. passwords,
+// and decrypts the "enc:" values of its other string fields. v is usually a pointer to a decoded section or resource.
+// Every field is tried, the errors of the fields that can not be resolved are joined.
+func ResolveSecretFields(v interface{}) error {
+	return resolveValue(reflect.ValueOf(v), "", false)
+}
+
+// resolveValue function
+func resolveValue(v reflect.Value, path string, secret bool) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return resolveValue(v.Elem(), path, secret)
+	case reflect.Struct:
+		var errs []error
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			p := path
+			if !f.Anonymous {
+				name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+				if name == "" || name == "-" {
+					name = f.Name
+				}
+				p = strings.TrimPrefix(path+"."+name, ".")
+			}
+			if err := resolveValue(v.Field(i), p, f.Tag.Get("secret") == "true"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	case reflect.Slice, reflect.Array:
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), secret); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	case reflect.Map:
+		var errs []error
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values are not addressable, resolve a copy
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(iter.Value())
+			if err := resolveValue(e, fmt.Sprintf("%s.%v", path, iter.Key()), secret); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			v.SetMapIndex(iter.Key(), e)
+		}
+		return errors.Join(errs...)
+	case reflect.String:
+		if !v.CanSet() || (!secret && !IsEncrypted(v.String())) {
+			return nil
+		}
+		s, err := ResolveSecret(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		v.SetString(s)
+	}
+
+	return nil
+}
+
+// envSecret function
+func envSecret(ref string) (string, error) {
+	if v, ok := os.LookupEnv(ref); ok {
+		return v, nil
+	}
+
+	return "", fmt.Errorf("environment variable %s is not set", ref)
+}
+
+// fileSecret function
+func fileSecret(ref string) (string, error) {
+	b, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
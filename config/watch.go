@@ -0,0 +1,178 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Subscriber is notified with the new and the previous config after a reload
+type Subscriber func(newConfig, oldConfig *Config)
+
+// Validator checks a reloaded config document before it replaces the current one
+type Validator func(byteConfig []byte) error
+
+var (
+	propertiesMu sync.RWMutex
+	reloadMu     sync.Mutex
+
+	hooksMu     sync.Mutex
+	subscribers []Subscriber
+	validators  []Validator
+)
+
+// Subscribe function registers a subscriber that is notified after the config is reloaded
+func Subscribe(s Subscriber) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	subscribers = append(subscribers, s)
+}
+
+// AddValidator function registers a validator that must pass before a reloaded config is used
+func AddValidator(v Validator) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	validators = append(validators, v)
+}
+
+// setProperties function swaps the current config and returns the previous one
+func setProperties(c *Config) *Config {
+	propertiesMu.Lock()
+	defer propertiesMu.Unlock()
+	old := Properties
+	Properties = c
+
+	return old
+}
+
+// Reload function re-reads the current config file, validates it and swaps Properties.
+// An invalid file is rejected and the previous config is kept.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	current := GetConfig()
+	if current == nil {
+		return errors.New("config not loaded")
+	}
+	byteConfig, files, err := loadByteConfig(current.ConfigPath)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(byteConfig, &doc); err != nil {
+		return err
+	}
+
+	hooksMu.Lock()
+	vs := append([]Validator(nil), validators...)
+	ss := append([]Subscriber(nil), subscribers...)
+	hooksMu.Unlock()
+
+	for _, v := range vs {
+		if err := v(byteConfig); err != nil {
+			return err
+		}
+	}
+
+	c := &Config{
+		ConfigPath: current.ConfigPath,
+		ByteConfig: byteConfig,
+		Files:      files,
+	}
+	old := setProperties(c)
+	for _, s := range ss {
+		s(c, old)
+	}
+
+	return nil
+}
+
+// loadByteConfig function reads the config files and merge them with the override layers
+func loadByteConfig(configPath string) ([]byte, []string, error) {
+	b, files, err := readProfile(configPath)
+	if err != nil {
+		return nil, files, err
+	}
+	b, err = buildByteConfig(b)
+
+	return b, files, err
+}
+
+// Watch function polls the config file every interval and reloads it when it changes.
+// Call the returned function to stop watching.
+func Watch(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	stopped := make(chan bool)
+	ticker := time.NewTicker(interval)
+	last := fileStamp()
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				stamp := fileStamp()
+				if stamp == last {
+					continue
+				}
+				last = stamp
+				if err := Reload(); err != nil {
+					log.Println("failed reload config, keep previous config, error: ", err)
+					continue
+				}
+				log.Println("config reloaded")
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopped)
+		})
+	}
+}
+
+// fileStamp function returns modification time and size of the current config files
+func fileStamp() string {
+	c := GetConfig()
+	if c == nil {
+		return ""
+	}
+	files := c.Files
+	if len(files) == 0 {
+		files = []string{c.ConfigPath}
+	}
+	if profile := getProfile(); profile != "" {
+		files = append(files, ProfilePath(c.ConfigPath, profile))
+	}
+	stamp := ""
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			stamp += fmt.Sprintf("%s:%s/%d;", f, fi.ModTime(), fi.Size())
+		}
+	}
+
+	return stamp
+}
@@ -17,6 +17,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/jasacloud/go-libraries/config"
 	"github.com/juju/mgo/v3"
@@ -28,12 +29,12 @@ import (
 
 // DbConfig struct
 type DbConfig struct {
-	Name     string `json:"name" bson:"name"`
+	Name     string `json:"name" bson:"name" validate:"required"`
 	Engine   string `json:"engine" bson:"engine"`
-	Host     string `json:"host" bson:"host"`
+	Host     string `json:"host" bson:"host" validate:"required"`
 	Port     string `json:"port" bson:"port"`
 	Username string `json:"username" bson:"username"`
-	Password string `json:"password" bson:"password"`
+	Password string `json:"password" bson:"password" secret:"true"`
 	Db       string `json:"db" bson:"db"`
 	Ssl      bool   `json:"ssl" bson:"ssl"`
 }
@@ -43,6 +44,11 @@ type DBServer struct {
 	DbServer []DbConfig `json:"dbResources" bson:"dbResources"`
 }
 
+func init() {
+	config.RegisterResources("dbResources", DbConfig{})
+	config.RegisterCloser("db", CloseAll)
+}
+
 // Properties variable
 var Properties *Mongo
 
@@ -55,6 +61,9 @@ var Resources = make(map[string]*Mongo)
 // SqlResources variable
 var SqlResources = make(map[string]*Sql)
 
+// resourcesMu guards Resources and SqlResources
+var resourcesMu sync.Mutex
+
 // Mongo struct
 type Mongo struct {
 	m          sync.RWMutex
@@ -83,16 +92,13 @@ var (
 )
 
 // getDBConf function
-func getDbConf(dbServer []DbConfig, resourceName string) DbConfig {
-
-	for _, v := range dbServer {
-		if v.Name == resourceName {
-			return v
-		}
+func getDbConf(resourceName string) DbConfig {
+	r, err := config.Resource[DbConfig]("dbResources", resourceName)
+	if err != nil {
+		fmt.Println("DB resourceName not loaded from config. resourceName: ", resourceName, ", error: ", err)
 	}
-	fmt.Println("DB resourceName not found in config. resourceName: ", resourceName)
 
-	return DbConfig{}
+	return r
 }
 
 // getDBUri function
@@ -179,13 +185,14 @@ func MgoParseURI(url string, rootCAs *x509.CertPool) (*mgo.DialInfo, error) {
 
 // UriConnect function
 func UriConnect(uri string) *Mongo {
+	resourcesMu.Lock()
+	r := Resources[uri]
+	resourcesMu.Unlock()
 
-	if Resources[uri] != nil {
-		err := Resources[uri].Sess.Ping()
+	if r != nil {
+		err := r.Sess.Ping()
 		if err != nil {
-			Resources[uri].Sess.Refresh()
-
-			return Resources[uri]
+			r.Sess.Refresh()
 		}
 	} else {
 		dialInfo, err := MgoParseURI(uri, nil)
@@ -216,33 +223,30 @@ func UriConnect(uri string) *Mongo {
 		}
 		db := Sess.DB(DbResource.Db)
 		Conn := db
-		Properties = &Mongo{
+		r, _ = storeMongo(uri, &Mongo{
 			DbResource: DbResource,
 			Sess:       Sess,
 			Conn:       Conn,
 			Uri:        uri,
-		}
-		Resources[uri] = Properties
+		})
 	}
 
-	return Resources[uri]
+	return r
 }
 
 // DbConnect function
 func DbConnect(resourceName string) *Mongo {
+	resourcesMu.Lock()
+	r := Resources[resourceName]
+	resourcesMu.Unlock()
 
-	if Resources[resourceName] != nil {
-		err := Resources[resourceName].Sess.Ping()
+	if r != nil {
+		err := r.Sess.Ping()
 		if err != nil {
-			Resources[resourceName].Sess.Refresh()
-
-			return Resources[resourceName]
+			r.Sess.Refresh()
 		}
 	} else {
-		c := config.GetConfig()
-		dbServer := DBServer{}
-		config.GetConf(c.ByteConfig, &dbServer)
-		var DbResource = getDbConf(dbServer.DbServer, resourceName)
+		var DbResource = getDbConf(resourceName)
 		uri := getDBUri(DbResource, false)
 		dialInfo, err := MgoParseURI(uri, nil)
 		if err != nil {
@@ -267,15 +271,33 @@ func DbConnect(resourceName string) *Mongo {
 
 		db := Sess.DB(DbResource.Db)
 		Conn := db
-		Properties = &Mongo{
+		var stored bool
+		r, stored = storeMongo(resourceName, &Mongo{
 			DbResource: DbResource,
 			Sess:       Sess,
 			Conn:       Conn,
+		})
+		if stored {
+			registerMongoHealth(resourceName)
 		}
-		Resources[resourceName] = Properties
 	}
 
-	return Resources[resourceName]
+	return r
+}
+
+// storeMongo function stores the connection of the resource unless another caller stored one
+// while it was dialed, then the connection is closed and the stored one is returned
+func storeMongo(name string, m *Mongo) (*Mongo, bool) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	if r := Resources[name]; r != nil {
+		m.Sess.Close()
+		return r, false
+	}
+	Properties = m
+	Resources[name] = m
+
+	return m, true
 }
 
 // DB method
@@ -351,9 +373,11 @@ func (d *Mongo) Refresh() {
 
 // CloseAll method
 func (d *Mongo) CloseAll() {
+	resourcesMu.Lock()
+	Resources[d.DbResource.Name] = nil
+	resourcesMu.Unlock()
 	d.m.Lock()
 	defer d.m.Unlock()
-	Resources[d.DbResource.Name] = nil
 	d.Sess.Close()
 }
 
@@ -366,6 +390,8 @@ func (d *Mongo) Close() {
 
 // Close function
 func Close(resourceName string) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
 	if Resources[resourceName] != nil {
 		Resources[resourceName].Sess.Close()
 	}
@@ -383,46 +409,64 @@ func GetDB() *Mongo {
 
 // SqlConnect function
 func SqlConnect(resourceName string) *Sql {
+	resourcesMu.Lock()
+	r := SqlResources[resourceName]
+	resourcesMu.Unlock()
 
-	if SqlResources[resourceName] != nil {
-		err := SqlResources[resourceName].Sess.Ping()
+	if r != nil {
+		err := r.Sess.Ping()
 		if err != nil {
 			log.Println("Error while ping sql:", err)
 			log.Println("Try to reconnect sql...")
-			dsn := getDSN(SqlResources[resourceName].DbResource, true)
+			dsn := getDSN(r.DbResource, true)
 			db, err := sql.Open("mysql", dsn)
 			if err != nil {
 				log.Println("cannot reconnect sql resources")
 				return nil
 			}
-			SqlProperties = &Sql{
-				DbResource: SqlResources[resourceName].DbResource,
+			r, _ = storeSql(resourceName, r, &Sql{
+				DbResource: r.DbResource,
 				Sess:       db,
 				Conn:       db,
-			}
-			SqlResources[resourceName] = SqlProperties
-			return SqlResources[resourceName]
+			})
 		}
 	} else {
-		c := config.GetConfig()
-		dbServer := DBServer{}
-		config.GetConf(c.ByteConfig, &dbServer)
-		var DbResource = getDbConf(dbServer.DbServer, resourceName)
+		var DbResource = getDbConf(resourceName)
 		dsn := getDSN(DbResource, true)
 		db, err := sql.Open("mysql", dsn)
 		if err != nil {
 			fmt.Println("DBConnect Error: ", err)
 		}
 		fmt.Printf("DB Conneted to %s on Port %s \n", DbResource.Host, DbResource.Port)
-		SqlProperties = &Sql{
+		var stored bool
+		r, stored = storeSql(resourceName, nil, &Sql{
 			DbResource,
 			db,
 			db,
+		})
+		if stored {
+			registerSqlHealth(resourceName)
+		}
+	}
+
+	return r
+}
+
+// storeSql function replaces the old connection of the resource, nil for none, with s unless another caller
+// replaced it while s was opened, then s is closed and the stored connection is returned
+func storeSql(name string, old, s *Sql) (*Sql, bool) {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	if r := SqlResources[name]; r != old && r != nil {
+		if s.Sess != nil {
+			_ = s.Sess.Close()
 		}
-		SqlResources[resourceName] = SqlProperties
+		return r, false
 	}
+	SqlProperties = s
+	SqlResources[name] = s
 
-	return SqlResources[resourceName]
+	return s, true
 }
 
 // getDSN function
@@ -435,3 +479,26 @@ func getDSN(dbConfig DbConfig, db bool) string {
 
 	return dsn
 }
+
+// CloseAll function closes every mongo and sql resource connection
+func CloseAll() error {
+	resourcesMu.Lock()
+	defer resourcesMu.Unlock()
+	for name, r := range Resources {
+		if r != nil && r.Sess != nil {
+			r.Close()
+		}
+		delete(Resources, name)
+	}
+	var errs []error
+	for name, r := range SqlResources {
+		if r != nil && r.Sess != nil {
+			if err := r.Sess.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+		delete(SqlResources, name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/jasacloud/go-libraries/health"
+)
+
+// registerMongoHealth function registers the readiness check of the mongo resource
+func registerMongoHealth(resourceName string) {
+	health.Register("mgo:"+resourceName, func(ctx context.Context) error {
+		resourcesMu.Lock()
+		r := Resources[resourceName]
+		resourcesMu.Unlock()
+		if r == nil || r.Sess == nil {
+			return errors.New("not connected")
+		}
+		s := r.Sess.Copy()
+		defer s.Close()
+		return s.Ping()
+	})
+}
+
+// registerSqlHealth function registers the readiness check of the sql resource
+func registerSqlHealth(resourceName string) {
+	health.Register("sql:"+resourceName, func(ctx context.Context) error {
+		resourcesMu.Lock()
+		r := SqlResources[resourceName]
+		resourcesMu.Unlock()
+		if r == nil || r.Sess == nil {
+			return errors.New("not connected")
+		}
+		return r.Sess.PingContext(ctx)
+	})
+}
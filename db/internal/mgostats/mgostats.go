@@ -0,0 +1,46 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mgostats exports the statistics of the mgo sessions, they are global to mgo
+// and shared by the db packages.
+package mgostats
+
+import (
+	"github.com/jasacloud/go-libraries/metrics"
+	"github.com/juju/mgo/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+var once sync.Once
+
+// Register function enables the mgo statistics and registers their metrics, once for every db package
+func Register() {
+	once.Do(func() {
+		mgo.SetStats(true)
+		_ = metrics.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "db_mgo_operations_sent_total",
+			Help: "Number of the operations sent by the mgo sessions.",
+		}, func() float64 {
+			return float64(mgo.GetStats().SentOps)
+		}))
+		metrics.OnCollect(collect)
+	})
+}
+
+// collect function updates the pool gauges of the mgo sessions
+func collect() {
+	stats := mgo.GetStats()
+	metrics.DbPoolConnections.WithLabelValues("mgo", "all", "open").Set(float64(stats.SocketsAlive))
+	metrics.DbPoolConnections.WithLabelValues("mgo", "all", "in_use").Set(float64(stats.SocketsInUse))
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoc
+
+import (
+	"context"
+	"errors"
+	"github.com/jasacloud/go-libraries/health"
+)
+
+// registerHealth function registers the readiness check of the mongo resource
+func registerHealth(resourceName string) {
+	health.Register("mongo:"+resourceName, func(ctx context.Context) error {
+		AllConnection.RLock()
+		c := AllConnection.Connections[resourceName]
+		AllConnection.RUnlock()
+		if c == nil || c.Client == nil {
+			return errors.New("not connected")
+		}
+		return c.CheckConnection()
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoc
+
+import (
+	"context"
+	"github.com/jasacloud/go-libraries/metrics"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// commandMonitor variable records the duration of every command of the clients
+var commandMonitor = &event.CommandMonitor{
+	Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+		metrics.DbOperationDuration.WithLabelValues("mongo", e.CommandName, "ok").Observe(e.Duration.Seconds())
+	},
+	Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+		metrics.DbOperationDuration.WithLabelValues("mongo", e.CommandName, "error").Observe(e.Duration.Seconds())
+	},
+}
+
+// poolMonitor variable tracks the open and in use connections of the pools by server address
+var poolMonitor = &event.PoolMonitor{
+	Event: func(e *event.PoolEvent) {
+		switch e.Type {
+		case event.ConnectionCreated:
+			metrics.DbPoolConnections.WithLabelValues("mongo", e.Address, "open").Inc()
+		case event.ConnectionClosed:
+			metrics.DbPoolConnections.WithLabelValues("mongo", e.Address, "open").Dec()
+		case event.ConnectionCheckedOut:
+			metrics.DbPoolConnections.WithLabelValues("mongo", e.Address, "in_use").Inc()
+		case event.ConnectionCheckedIn:
+			metrics.DbPoolConnections.WithLabelValues("mongo", e.Address, "in_use").Dec()
+		}
+	},
+}
@@ -16,6 +16,7 @@ package mongoc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/jasacloud/go-libraries/config"
 	"github.com/jasacloud/go-libraries/utils/masker"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -30,12 +31,12 @@ import (
 
 // Resource struct
 type Resource struct {
-	Name     string `json:"name" bson:"name"`
-	Uri      string `json:"uri" bson:"uri"`
-	Host     string `json:"host" bson:"host"`
+	Name     string `json:"name" bson:"name" validate:"required"`
+	Uri      string `json:"uri" bson:"uri" secret:"true"`
+	Host     string `json:"host" bson:"host" validate:"required_without=Uri"`
 	Port     string `json:"port" bson:"port"`
 	Username string `json:"username" bson:"username"`
-	Password string `json:"password" bson:"password"`
+	Password string `json:"password" bson:"password" secret:"true"`
 	Db       string `json:"db" bson:"db"`
 	Ssl      bool   `json:"ssl" bson:"ssl"`
 }
@@ -45,6 +46,11 @@ type DBResources struct {
 	Resources []*Resource `json:"mongoResources" bson:"mongoResources"`
 }
 
+func init() {
+	config.RegisterResources("mongoResources", Resource{})
+	config.RegisterCloser("mongo", CloseAll)
+}
+
 // Connections struct
 type Connections struct {
 	sync.RWMutex
@@ -90,6 +96,17 @@ func GetResource(resources []*Resource, resourceName string) *Resource {
 	return nil
 }
 
+// getResource function returns the resource of the current config, nil when it can not be loaded
+func getResource(resourceName string) *Resource {
+	r, err := config.Resource[Resource]("mongoResources", resourceName)
+	if err != nil {
+		log.Println("DB resourceName not loaded from config. resourceName:", resourceName, "error:", err)
+		return nil
+	}
+
+	return &r
+}
+
 // GenerateURI function
 func GenerateURI(option *Resource, db bool) string {
 	uri := ""
@@ -144,6 +161,8 @@ func connectURI(uri string) (*Connections, error) {
 	clientOptions.ApplyURI(uri)
 	clientOptions.SetConnectTimeout(15 * time.Second)
 	clientOptions.SetServerSelectionTimeout(15 * time.Second)
+	clientOptions.SetMonitor(commandMonitor)
+	clientOptions.SetPoolMonitor(poolMonitor)
 	err := clientOptions.Validate()
 	if err != nil {
 		return nil, err
@@ -187,10 +206,10 @@ func connectURI(uri string) (*Connections, error) {
 
 // connect function
 func connect(resourceName string) (*Connections, error) {
-	c := config.GetConfig()
-	var dbResources DBResources
-	config.GetConf(c.ByteConfig, &dbResources)
-	var resource = GetResource(dbResources.Resources, resourceName)
+	var resource = getResource(resourceName)
+	if resource == nil {
+		return nil, errors.New("DB resource " + resourceName + " is not loaded")
+	}
 	uri := ""
 	if resource.Uri != "" {
 		uri = resource.Uri
@@ -247,6 +266,7 @@ func NewConnection(resourceName string) (*Connections, error) {
 		return nil, err
 	}
 	AllConnection.Connections[resourceName] = connection
+	registerHealth(resourceName)
 
 	return AllConnection.Connections[resourceName], nil
 }
@@ -400,3 +420,20 @@ func yieldIndexModel() mongo.IndexModel {
 
 	return index
 }
+
+// CloseAll function disconnects every client of AllConnection
+func CloseAll() error {
+	AllConnection.Lock()
+	defer AllConnection.Unlock()
+	var errs []error
+	for name, c := range AllConnection.Connections {
+		if c != nil && c.Client != nil {
+			if err := c.Client.Disconnect(context.TODO()); err != nil && !errors.Is(err, mongo.ErrClientDisconnected) {
+				errs = append(errs, fmt.Errorf("%s: %w", masker.UriPassword(name), err))
+			}
+		}
+		delete(AllConnection.Connections, name)
+	}
+
+	return errors.Join(errs...)
+}
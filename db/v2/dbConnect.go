@@ -17,6 +17,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"github.com/jasacloud/go-libraries/config"
 	"github.com/jasacloud/go-libraries/utils/masker"
 	"github.com/juju/mgo/v3"
@@ -28,12 +29,12 @@ import (
 
 // Resource struct
 type Resource struct {
-	Name     string `json:"name" bson:"name"`
+	Name     string `json:"name" bson:"name" validate:"required"`
 	Engine   string `json:"engine" bson:"engine"`
-	Host     string `json:"host" bson:"host"`
+	Host     string `json:"host" bson:"host" validate:"required"`
 	Port     string `json:"port" bson:"port"`
 	Username string `json:"username" bson:"username"`
-	Password string `json:"password" bson:"password"`
+	Password string `json:"password" bson:"password" secret:"true"`
 	Db       string `json:"db" bson:"db"`
 	Ssl      bool   `json:"ssl" bson:"ssl"`
 }
@@ -43,6 +44,11 @@ type DBResources struct {
 	Resources []*Resource `json:"dbResources" bson:"dbResources"`
 }
 
+func init() {
+	config.RegisterResources("dbResources", Resource{})
+	config.RegisterCloser("db", CloseAll)
+}
+
 // Connections struct
 type Connections struct {
 	sync.RWMutex
@@ -89,6 +95,17 @@ func GetResource(resources []*Resource, resourceName string) *Resource {
 	return nil
 }
 
+// getResource function returns the resource of the current config, nil when it can not be loaded
+func getResource(resourceName string) *Resource {
+	r, err := config.Resource[Resource]("dbResources", resourceName)
+	if err != nil {
+		log.Println("DB resourceName not loaded from config. resourceName:", resourceName, "error:", err)
+		return nil
+	}
+
+	return &r
+}
+
 // GenerateURI function
 func GenerateURI(option *Resource, db bool) string {
 	uri := ""
@@ -209,10 +226,7 @@ func connectURI(uri string) (*Connections, error) {
 }
 
 func connect(resourceName string) (*Connections, error) {
-	c := config.GetConfig()
-	var dbResources DBResources
-	config.GetConf(c.ByteConfig, &dbResources)
-	var resource = GetResource(dbResources.Resources, resourceName)
+	var resource = getResource(resourceName)
 	uri := GenerateURI(resource, true)
 
 	connection, err := connectURI(uri)
@@ -267,6 +281,7 @@ func NewConnection(resourceName string) (*Connections, error) {
 			return nil, err
 		}
 		AllConnection.Connections[resourceName] = connection
+		registerMongoHealth(resourceName)
 	}
 
 	return AllConnection.Connections[resourceName], nil
@@ -366,3 +381,29 @@ func Close(resourceName string) {
 	}
 	AllConnection.Connections[resourceName] = nil
 }
+
+// CloseAll function closes every connection of AllConnection and AllSqlConnection
+func CloseAll() error {
+	AllConnection.Lock()
+	for name, c := range AllConnection.Connections {
+		if c != nil && c.Session != nil {
+			c.Close()
+		}
+		delete(AllConnection.Connections, name)
+	}
+	AllConnection.Unlock()
+
+	AllSqlConnection.Lock()
+	defer AllSqlConnection.Unlock()
+	var errs []error
+	for name, c := range AllSqlConnection.Connections {
+		if c != nil && c.Database != nil {
+			if err := c.Database.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", masker.UriPassword(name), err))
+			}
+		}
+		delete(AllSqlConnection.Connections, name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -3,7 +3,6 @@ package db
 import (
 	"database/sql"
 	"errors"
-	"github.com/jasacloud/go-libraries/config"
 	"log"
 	"sync"
 
@@ -61,10 +60,10 @@ func sqlConnectURI(uri string) (*SqlConnections, error) {
 
 // sqlConnect function
 func sqlConnect(resourceName string) (*SqlConnections, error) {
-	c := config.GetConfig()
-	var dbResources DBResources
-	config.GetConf(c.ByteConfig, &dbResources)
-	var resource = GetResource(dbResources.Resources, resourceName)
+	var resource = getResource(resourceName)
+	if resource == nil {
+		return nil, errors.New("DB resource " + resourceName + " is not loaded")
+	}
 	uri := GenerateDSN(resource, true)
 
 	connection, err := sqlConnectURI(uri)
@@ -129,6 +128,7 @@ func NewSqlConnection(resourceName string) (*SqlConnections, error) {
 			return nil, err
 		}
 		AllSqlConnection.Connections[resourceName] = connection
+		registerSqlHealth(resourceName)
 	}
 
 	return AllSqlConnection.Connections[resourceName], nil
@@ -0,0 +1,47 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"github.com/jasacloud/go-libraries/db/internal/mgostats"
+	"github.com/jasacloud/go-libraries/metrics"
+	"github.com/jasacloud/go-libraries/utils/masker"
+)
+
+func init() {
+	mgostats.Register()
+	metrics.OnCollect(collectPools)
+}
+
+// collectPools function updates the pool gauges of the sql connections
+func collectPools() {
+	AllSqlConnection.RLock()
+	defer AllSqlConnection.RUnlock()
+	for name, c := range AllSqlConnection.Connections {
+		if c == nil || c.Database == nil {
+			continue
+		}
+		resource := name
+		if c.Option != nil && c.Option.Name != "" {
+			resource = c.Option.Name
+		} else {
+			// the name is a dsn, do not expose its credentials
+			resource = masker.UriPassword(name)
+		}
+		s := c.Database.Stats()
+		metrics.DbPoolConnections.WithLabelValues("sql", resource, "open").Set(float64(s.OpenConnections))
+		metrics.DbPoolConnections.WithLabelValues("sql", resource, "in_use").Set(float64(s.InUse))
+		metrics.DbPoolConnections.WithLabelValues("sql", resource, "idle").Set(float64(s.Idle))
+	}
+}
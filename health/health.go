@@ -0,0 +1,195 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health holds the readiness checks of the service components. The resource packages register
+// a check for each resource they connect, e.g. "mongo:default", services register their own with Register.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout constant is the time a check may take before it is reported down
+	DefaultTimeout = 2 * time.Second
+	// DefaultCacheTTL constant is the time the result of a check is reused by the next evaluations
+	DefaultCacheTTL = 3 * time.Second
+
+	// StatusUp constant
+	StatusUp string = "up"
+	// StatusDown constant
+	StatusDown string = "down"
+)
+
+// ErrTimeout variable
+var ErrTimeout = errors.New("health check timed out")
+
+// CheckFunc type reports the component is not ready by returning an error
+type CheckFunc func(ctx context.Context) error
+
+// Options struct
+type Options struct {
+	// Timeout default to DefaultTimeout
+	Timeout time.Duration
+	// CacheTTL default to DefaultCacheTTL, negative disables the cache
+	CacheTTL time.Duration
+	// Optional checks are reported but do not make the service not ready
+	Optional bool
+}
+
+// Component struct is the result of a check
+type Component struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Optional  bool      `json:"optional,omitempty"`
+	LatencyMs float64   `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report struct
+type Report struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components,omitempty"`
+}
+
+// Ready method reports whether every required component is up
+func (r Report) Ready() bool {
+	return r.Status == StatusUp
+}
+
+// check struct
+type check struct {
+	mu      sync.Mutex
+	name    string
+	fn      CheckFunc
+	opt     Options
+	last    Component
+	expires time.Time
+}
+
+var (
+	checksMu sync.RWMutex
+	checks   = make(map[string]*check)
+)
+
+// Register function registers the check of the component name, replacing the existing one
+func Register(name string, fn CheckFunc, opts ...Options) {
+	var opt Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultTimeout
+	}
+	if opt.CacheTTL == 0 {
+		opt.CacheTTL = DefaultCacheTTL
+	}
+
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	checks[name] = &check{name: name, fn: fn, opt: opt}
+}
+
+// Unregister function
+func Unregister(name string) {
+	checksMu.Lock()
+	defer checksMu.Unlock()
+	delete(checks, name)
+}
+
+// Check function evaluates every registered check concurrently, the components are sorted by name
+func Check(ctx context.Context) Report {
+	checksMu.RLock()
+	list := make([]*check, 0, len(checks))
+	for _, c := range checks {
+		list = append(list, c)
+	}
+	checksMu.RUnlock()
+
+	report := Report{
+		Status:     StatusUp,
+		Components: make([]Component, len(list)),
+	}
+	var wg sync.WaitGroup
+	for i, c := range list {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Components[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].Name < report.Components[j].Name
+	})
+	for _, c := range report.Components {
+		if c.Status != StatusUp && !c.Optional {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+// run method returns the cached result or evaluates the check within its timeout.
+// A check ignoring its context is left running in background once it timed out.
+func (c *check) run(ctx context.Context) Component {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Before(c.expires) {
+		return c.last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.opt.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("health check panic: %v", r)
+			}
+		}()
+		done <- c.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	c.last = Component{
+		Name:      c.name,
+		Status:    StatusUp,
+		Optional:  c.opt.Optional,
+		LatencyMs: float64(time.Since(now).Microseconds()) / 1000,
+		CheckedAt: now,
+	}
+	if err != nil {
+		c.last.Status = StatusDown
+		c.last.Error = err.Error()
+	}
+	if c.opt.CacheTTL > 0 {
+		c.expires = now.Add(c.opt.CacheTTL)
+	}
+
+	return c.last
+}
@@ -94,16 +94,27 @@ func PairValues(i, o interface{}) error {
 	return nil
 }
 
+// ValidateStructJSON function validates o and reports the fields by their json names
+func ValidateStructJSON(o interface{}) error {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonTagName)
+
+	return v.Struct(o)
+}
+
 func JsonTagNameFunc() {
 	if f := reflect.ValueOf(binding.Validator.Engine()).MethodByName("RegisterTagNameFunc"); f.IsValid() {
 		var args []reflect.Value
-		args = append(args, reflect.ValueOf(func(fld reflect.StructField) string {
-			name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
-			if name == "-" {
-				return ""
-			}
-			return name
-		}))
+		args = append(args, reflect.ValueOf(jsonTagName))
 		f.Call(args)
 	}
 }
+
+// jsonTagName function
+func jsonTagName(fld reflect.StructField) string {
+	name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -43,15 +43,19 @@ type logWriter struct {
 	ext         string
 	name        string
 	day         int
+	raw         bool
 	Output      *os.File
 }
 
 // Write method
 func (w *logWriter) Write(bytes []byte) (int, error) {
 	s := time.Now().Format("2006-01-02T15:04:05.000Z") + " [DEBUG] " + string(bytes)
+	if w.raw {
+		s = string(bytes)
+	}
 	w.Lock()
 	defer w.Unlock()
-	err := w.ReopenIfNeeded()
+	err := w.reopenIfNeeded()
 	if err != nil {
 		fmt.Println("Failed while rotate log...")
 
@@ -62,12 +66,17 @@ func (w *logWriter) Write(bytes []byte) (int, error) {
 
 // ReopenIfNeeded method
 func (w *logWriter) ReopenIfNeeded() (err error) {
+	w.Lock()
+	defer w.Unlock()
+	return w.reopenIfNeeded()
+}
+
+// reopenIfNeeded method rotates the file when the day changed, the caller holds the lock
+func (w *logWriter) reopenIfNeeded() (err error) {
 	t := time.Now()
 	if t.YearDay() == w.day {
 		return nil
 	}
-	w.Lock()
-	defer w.Unlock()
 	err = w.Output.Close()
 	if err != nil {
 		return err
@@ -75,7 +84,7 @@ func (w *logWriter) ReopenIfNeeded() (err error) {
 	return w.Reopen()
 }
 
-// Reopen method
+// Reopen method opens the file of the current day, the caller holds the lock
 func (w *logWriter) Reopen() error {
 
 	t := time.Now()
@@ -97,6 +106,9 @@ func (w *logWriter) Reopen() error {
 	}
 
 	w.Output = f
+	if w.raw {
+		return nil
+	}
 	log.New(w.Output, "", log.Ldate|log.Ltime)
 	log.SetOutput(w.Output)
 	log.Println("--------  NEW LOG ROTATED  --------")
@@ -140,3 +152,15 @@ func NewLogFile(output string) (*logWriter, error) {
 
 	return lw, nil
 }
+
+// NewRawLogFile function opens a daily rotated log file that writes the records as is,
+// without the time prefix and without taking over the standard logger output
+func NewRawLogFile(output string) (*logWriter, error) {
+	lw, err := NewLogFile(output)
+	if err != nil {
+		return nil, err
+	}
+	lw.raw = true
+
+	return lw, nil
+}
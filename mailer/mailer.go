@@ -19,8 +19,10 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"github.com/jasacloud/go-libraries/client"
 	"github.com/jasacloud/go-libraries/config"
+	"github.com/jasacloud/go-libraries/metrics"
 	"github.com/jasacloud/go-libraries/system"
 	"gopkg.in/gomail.v2"
 	"io"
@@ -32,16 +34,16 @@ import (
 
 // MailOption struct
 type MailOption struct {
-	Name       string `json:"name" bson:"name"`
+	Name       string `json:"name" bson:"name" validate:"required"`
 	Protocol   string `json:"protocol" bson:"protocol"`
-	Host       string `json:"host" bson:"host"`
-	Port       int    `json:"port" bson:"port"`
+	Host       string `json:"host" bson:"host" validate:"required"`
+	Port       int    `json:"port" bson:"port" validate:"min=0,max=65535"`
 	SecureType string `json:"secureType" bson:"secureType"`
 	Sender     string `json:"sender" bson:"sender"`
 	SenderName string `json:"senderName" bson:"senderName"`
 	Auth       bool   `json:"auth" bson:"auth"`
 	UserName   string `json:"userName" bson:"userName"`
-	Password   string `json:"password" bson:"password"`
+	Password   string `json:"password" bson:"password" secret:"true"`
 }
 
 // MailConf struct
@@ -49,6 +51,10 @@ type MailConf struct {
 	MailOption []MailOption `json:"mailResources" bson:"mailResources"`
 }
 
+func init() {
+	config.RegisterResources("mailResources", MailOption{})
+}
+
 // Mailer struct
 type Mailer struct {
 	d       *gomail.Dialer
@@ -92,22 +98,18 @@ const (
 )
 
 var (
-	// Mail variable
+	// Mail variable is not updated anymore, use GetMailResource which reads the current config
 	Mail MailConf
 )
 
 // GetMailResource function
 func GetMailResource(resourceName string) MailOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Mail)
-	for _, v := range Mail.MailOption {
-		if v.Name == resourceName {
-
-			return v
-		}
+	r, err := config.Resource[MailOption]("mailResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load mail resource "+resourceName+", error: ", err)
 	}
 
-	return MailOption{}
+	return r
 }
 
 // EmailDial function
@@ -220,7 +222,7 @@ func (mailer *Mailer) Send(to string, cc string, subject string, contentType str
 		}
 	}
 	mailer.m = m
-	return gomail.Send(mailer.s, mailer.m)
+	return countSent(gomail.Send(mailer.s, mailer.m))
 }
 
 // SendWithAttachments method
@@ -249,7 +251,7 @@ func (mailer *Mailer) SendWithAttachments(to string, cc string, subject string,
 		log.Println(err)
 	}
 
-	return gomail.Send(mailer.s, mailer.m)
+	return countSent(gomail.Send(mailer.s, mailer.m))
 }
 
 // SendWithAttachments method
@@ -282,7 +284,7 @@ func (mailer *Mailer) SendWithAttachmentsEmbeds(to string, cc string, subject st
 		log.Println(err)
 	}
 
-	return gomail.Send(mailer.s, mailer.m)
+	return countSent(gomail.Send(mailer.s, mailer.m))
 }
 
 // setAttachments method
@@ -504,7 +506,7 @@ func SendEmail(resourceName string, to string, cc string, subject string, conten
 	}
 
 	// Send the email to Bob, Cora and Dan.
-	return d.DialAndSend(m)
+	return countSent(d.DialAndSend(m))
 }
 
 // GetMessageId method
@@ -515,3 +517,10 @@ func (mailer *Mailer) GetMessageId() string {
 	}
 	return ""
 }
+
+// countSent function counts the sent email by the send result
+func countSent(err error) error {
+	metrics.MailerMessagesSent.WithLabelValues(metrics.Status(err)).Inc()
+
+	return err
+}
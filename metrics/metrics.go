@@ -0,0 +1,145 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics holds the Prometheus metrics of the libraries, served by Handler in the text exposition format.
+// Nothing is pushed, a Prometheus server scrapes the endpoint when it is configured to.
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+var (
+	// Registry variable is the registry of every metric of the libraries
+	Registry = prometheus.NewRegistry()
+
+	// HttpRequestDuration variable is the latency of the handled requests by route template and status
+	HttpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_server_request_duration_seconds",
+		Help:    "Duration of the handled HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	// HttpRequestsInFlight variable
+	HttpRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "http_server_requests_in_flight",
+		Help: "Number of the HTTP requests being handled.",
+	})
+	// HttpClientRequestDuration variable is the latency of the outbound requests by host and status
+	HttpClientRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "Duration of the outbound HTTP requests, status is \"error\" when no response is received.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "host", "status"})
+	// DbOperationDuration variable is the latency of the database operations by driver and operation,
+	// recorded by the command monitor of the mongo driver
+	DbOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_operation_duration_seconds",
+		Help:    "Duration of the database operations.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"driver", "operation", "status"})
+	// DbPoolConnections variable is the number of pooled connections by driver, resource and state
+	DbPoolConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "db_pool_connections",
+		Help: "Number of the database pool connections by state.",
+	}, []string{"driver", "resource", "state"})
+	// BrokerMessagesPublished variable, the destination is the amqp exchange, or the queue for the default
+	// exchange, and the nats resource
+	BrokerMessagesPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_messages_published_total",
+		Help: "Number of the messages published to the broker.",
+	}, []string{"broker", "destination", "status"})
+	// BrokerMessagesConsumed variable, the destination is the amqp queue and the subscribed nats subject
+	BrokerMessagesConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "broker_messages_consumed_total",
+		Help: "Number of the messages consumed from the broker.",
+	}, []string{"broker", "destination"})
+	// MailerMessagesSent variable
+	MailerMessagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mailer_messages_sent_total",
+		Help: "Number of the emails sent by status.",
+	}, []string{"status"})
+
+	collectMu    sync.Mutex
+	collectFuncs []func()
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HttpRequestDuration,
+		HttpRequestsInFlight,
+		HttpClientRequestDuration,
+		DbOperationDuration,
+		DbPoolConnections,
+		BrokerMessagesPublished,
+		BrokerMessagesConsumed,
+		MailerMessagesSent,
+	)
+}
+
+// Register function registers the collector in Registry, a collector registered already is ignored
+func Register(c prometheus.Collector) error {
+	err := Registry.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return nil
+	}
+
+	return err
+}
+
+// OnCollect function registers f to run before each scrape, e.g. to update the pool gauges from driver stats
+func OnCollect(f func()) {
+	collectMu.Lock()
+	defer collectMu.Unlock()
+	collectFuncs = append(collectFuncs, f)
+}
+
+// Gather function runs the collect functions and gathers Registry
+func Gather() ([]*dto.MetricFamily, error) {
+	collectMu.Lock()
+	fs := collectFuncs
+	collectMu.Unlock()
+	for _, f := range fs {
+		f()
+	}
+
+	return Registry.Gather()
+}
+
+// Handler function returns the http handler serving the metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.GathererFunc(Gather), promhttp.HandlerOpts{})
+}
+
+// Status function returns the status label of an operation result
+func Status(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "ok"
+}
+
+// StatusCode function returns the status label of an http status code
+func StatusCode(code int) string {
+	return strconv.Itoa(code)
+}
@@ -0,0 +1,528 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-contrib/cache/persistence"
+	"github.com/gin-gonic/gin"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jasacloud/go-libraries/cache"
+	"github.com/jasacloud/go-libraries/helper"
+	"github.com/jasacloud/go-libraries/server"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader constant is the request header of the idempotency key
+	IdempotencyKeyHeader string = "Idempotency-Key"
+	// IdempotentReplayedHeader constant marks the replayed responses
+	IdempotentReplayedHeader string = "Idempotent-Replayed"
+
+	// DefaultIdempotencyTTLSec constant
+	DefaultIdempotencyTTLSec int = 86400
+	// DefaultIdempotencyLockSec constant
+	DefaultIdempotencyLockSec int = 60
+	// DefaultIdempotencyMaxBodySize constant
+	DefaultIdempotencyMaxBodySize int = 1 << 20
+
+	// idempotencyMaxKey is the maximum length of an idempotency key
+	idempotencyMaxKey = 255
+	// idempotencySkipKey is the context key set by SkipIdempotency
+	idempotencySkipKey = "idempotency_skip"
+)
+
+// DefaultIdempotencyMethods variable
+var DefaultIdempotencyMethods = []string{http.MethodPost, http.MethodPatch}
+
+// errIdempotencyContended variable
+var errIdempotencyContended = errors.New("idempotency key contended")
+
+// IdempotencyOption struct
+type IdempotencyOption struct {
+	// Name prefixes the keys of the middleware, middlewares sharing a store must have distinct names
+	Name string `json:"name" bson:"name"`
+	// TTLSec is the time a response is replayed, default to a day
+	TTLSec int `json:"ttlSec" bson:"ttlSec" validate:"min=0"`
+	// LockSec is the time a request in flight holds its key, default to 60,
+	// a duplicate arriving later than it is run again
+	LockSec int `json:"lockSec" bson:"lockSec" validate:"min=0"`
+	// Methods are the idempotent methods, POST and PATCH by default
+	Methods []string `json:"methods" bson:"methods"`
+	// Scope is "credential" (default) for keys of each credential, "ip", "claim:<name>", e.g. "claim:sub",
+	// "header:<name>", or "global" for keys shared by every client
+	Scope string `json:"scope" bson:"scope"`
+	// Required rejects the requests without the Idempotency-Key header
+	Required bool `json:"required" bson:"required"`
+	// MaxBodySize is the size of the biggest stored response, default to 1MB
+	MaxBodySize int `json:"maxBodySize" bson:"maxBodySize" validate:"min=0"`
+	// Store is "memory" (default), "redis:<redisResources name>" or "memcached:<memcachedResources name>"
+	Store string `json:"store" bson:"store"`
+}
+
+// IdempotencyRecord struct is the stored state of a key, the fingerprint of its request
+// and the response once it is completed
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	InFlight    bool        `json:"inFlight"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// IdempotencyStore interface keeps the records of the keys
+type IdempotencyStore interface {
+	// Lock stores the record when the key is free and returns nil, otherwise it returns the stored record
+	Lock(key string, rec IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error)
+	// Save replaces the record of the key
+	Save(key string, rec IdempotencyRecord, ttl time.Duration) error
+	// Release frees the key
+	Release(key string) error
+}
+
+// Idempotency function returns a middleware replaying the response of the first request of an Idempotency-Key,
+// so a retried request is not processed twice. The store defaults to the store of opt.Store.
+// A duplicate of a request in flight is answered with status 409, a key reused by another request
+// with status 422, both with the returnval/error envelope. The responses of the requests failing with
+// c.Error, a 5xx status, a panic or a JSON body with returnval false, the responses bigger than MaxBodySize
+// and the ones of the handlers calling SkipIdempotency are not stored, the client may retry them.
+// Requests are processed as usual when the store fails.
+func Idempotency(opt IdempotencyOption, store ...IdempotencyStore) gin.HandlerFunc {
+	if err := helper.ValidateStructJSON(opt); err != nil {
+		log.Fatalf("idempotency %s: %v", opt.Name, err)
+	}
+	var scope RateLimitKeyFunc = KeyByCredential
+	if opt.Scope == "global" {
+		scope = nil
+	} else if opt.Scope != "" {
+		var err error
+		if scope, err = keyFuncOf(opt.Scope); err != nil {
+			log.Fatalf("idempotency %s: %v", opt.Name, err)
+		}
+	}
+	var s IdempotencyStore
+	if len(store) > 0 && store[0] != nil {
+		s = store[0]
+	} else {
+		var err error
+		if s, err = NewIdempotencyStore(opt.Store); err != nil {
+			log.Fatalf("idempotency %s: %v", opt.Name, err)
+		}
+	}
+	ttl := time.Duration(DefaultIdempotencyTTLSec) * time.Second
+	if opt.TTLSec > 0 {
+		ttl = time.Duration(opt.TTLSec) * time.Second
+	}
+	lock := time.Duration(DefaultIdempotencyLockSec) * time.Second
+	if opt.LockSec > 0 {
+		lock = time.Duration(opt.LockSec) * time.Second
+	}
+	maxBody := DefaultIdempotencyMaxBodySize
+	if opt.MaxBodySize > 0 {
+		maxBody = opt.MaxBodySize
+	}
+	methods := opt.Methods
+	if len(methods) == 0 {
+		methods = DefaultIdempotencyMethods
+	}
+	prefix := "idempotency:" + opt.Name + ":"
+
+	return func(c *gin.Context) {
+		if !containsFold(methods, c.Request.Method) {
+			c.Next()
+			return
+		}
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			if opt.Required {
+				idempotencyError(c, http.StatusBadRequest, "Idempotency-Key Required")
+				return
+			}
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyMaxKey {
+			idempotencyError(c, http.StatusBadRequest, "Invalid Idempotency-Key")
+			return
+		}
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			idempotencyError(c, http.StatusBadRequest, "Invalid Request Body")
+			return
+		}
+		if scope != nil {
+			key = scope(c) + ":" + key
+		}
+		key = prefix + key
+
+		stored, err := s.Lock(key, IdempotencyRecord{Fingerprint: fingerprint, InFlight: true}, lock)
+		if err != nil {
+			log.Println("Idempotency error:", err)
+			c.Next()
+			return
+		}
+		if stored != nil {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				idempotencyError(c, http.StatusUnprocessableEntity, "Idempotency-Key Reused With Another Request")
+			case stored.InFlight:
+				c.Header("Retry-After", "1")
+				idempotencyError(c, http.StatusConflict, "Request In Progress")
+			default:
+				replay(c, stored)
+			}
+			return
+		}
+
+		w := &idempotencyWriter{ResponseWriter: c.Writer, limit: maxBody, before: c.Writer.Header().Clone()}
+		c.Writer = w
+		saved := false
+		defer func() {
+			// the panicking, failed and unstored requests free their key
+			if !saved {
+				if err := s.Release(key); err != nil {
+					log.Println("Idempotency error:", err)
+				}
+			}
+		}()
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		status := w.Status()
+		if len(c.Errors) > 0 || status >= 500 || w.overflow || w.hijacked || c.GetBool(idempotencySkipKey) {
+			return
+		}
+		header := w.header
+		if header == nil {
+			header = handlerHeader(w.before, w.Header())
+		}
+		if failedResponse(header, w.body.Bytes()) {
+			return
+		}
+		err = s.Save(key, IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      header,
+			Body:        w.body.Bytes(),
+		}, ttl)
+		if err != nil {
+			log.Println("Idempotency error:", err)
+			return
+		}
+		saved = true
+	}
+}
+
+// SkipIdempotency function keeps the response of the request out of the idempotency store,
+// e.g. for a business failure answered with a 2xx status the client may retry
+func SkipIdempotency(c *gin.Context) {
+	c.Set(idempotencySkipKey, true)
+}
+
+// failedResponse function reports a JSON body of the returnval envelope with returnval false
+func failedResponse(header http.Header, body []byte) bool {
+	if !strings.Contains(header.Get("Content-Type"), "json") || !bytes.Contains(body, []byte(`"returnval"`)) {
+		return false
+	}
+	var envelope struct {
+		Returnval *bool `json:"returnval"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return false
+	}
+
+	return envelope.Returnval != nil && !*envelope.Returnval
+}
+
+// containsFold function
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestFingerprint function hashes the method, the URI and the body of the request,
+// the body is restored for the handlers
+func requestFingerprint(c *gin.Context) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		b, err := io.ReadAll(c.Request.Body)
+		_ = c.Request.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(b))
+		h.Write(b)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// idempotencyError function
+func idempotencyError(c *gin.Context, status int, message string) {
+	body := server.ErrorResponse(fmt.Sprint(status), message, c)
+	body["type"] = "Idempotency"
+	c.AbortWithStatusJSON(status, gin.H{
+		"returnval": false,
+		"error":     body,
+	})
+}
+
+// replay function writes the stored response
+func replay(c *gin.Context, rec *IdempotencyRecord) {
+	h := c.Writer.Header()
+	for k, v := range rec.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set(IdempotentReplayedHeader, "true")
+	c.Status(rec.Status)
+	if len(rec.Body) > 0 {
+		_, _ = c.Writer.Write(rec.Body)
+	} else {
+		c.Writer.WriteHeaderNow()
+	}
+	c.Abort()
+}
+
+// idempotencyWriter struct copies the response, the header is taken when the response is written,
+// before the outer writers, e.g. the compression, add theirs. Only the header set by the handlers
+// is kept, the one set before, e.g. the request ID and the rate limit, belongs to each request.
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	limit    int
+	before   http.Header
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+	hijacked bool
+}
+
+// snapshot method
+func (w *idempotencyWriter) snapshot() {
+	if w.header == nil {
+		w.header = handlerHeader(w.before, w.Header())
+	}
+}
+
+// handlerHeader function returns the fields of the header added or changed since before
+func handlerHeader(before, header http.Header) http.Header {
+	h := make(http.Header)
+	for k, v := range header {
+		if !slices.Equal(before[k], v) {
+			h[k] = append([]string(nil), v...)
+		}
+	}
+
+	return h
+}
+
+// WriteHeaderNow method
+func (w *idempotencyWriter) WriteHeaderNow() {
+	w.snapshot()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Write method
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.snapshot()
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.limit {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString method
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush method
+func (w *idempotencyWriter) Flush() {
+	w.snapshot()
+	w.ResponseWriter.Flush()
+}
+
+// Hijack method
+func (w *idempotencyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.ResponseWriter.Hijack()
+}
+
+// Unwrap method
+func (w *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// NewIdempotencyStore function returns the store of the spec, "memory",
+// "redis:<redisResources name>" or "memcached:<memcachedResources name>"
+func NewIdempotencyStore(spec string) (IdempotencyStore, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "" || kind == "memory":
+		return NewCacheIdempotencyStore(persistence.NewInMemoryStore(time.Minute)), nil
+	case kind == "redis" && name != "":
+		if cache.GetRedisResource(name).Host == "" {
+			return nil, fmt.Errorf("redis resource %q not found", name)
+		}
+		return NewRedisIdempotencyStore(cache.RdPool(name)), nil
+	case kind == "memcached" && name != "":
+		if len(cache.GetMemcachedResource(name).Host) == 0 {
+			return nil, fmt.Errorf("memcached resource %q not found", name)
+		}
+		return NewCacheIdempotencyStore(cache.McConnect(name)), nil
+	}
+
+	return nil, fmt.Errorf("invalid idempotency store %q", spec)
+}
+
+// CacheIdempotencyStore struct keeps the records in a cache store, e.g. persistence.NewInMemoryStore
+// or cache.McConnect. The lock relies on the Add of the store, which cache.RdConnect does not make atomic,
+// use RedisIdempotencyStore for redis.
+type CacheIdempotencyStore struct {
+	store persistence.CacheStore
+}
+
+// NewCacheIdempotencyStore function
+func NewCacheIdempotencyStore(store persistence.CacheStore) *CacheIdempotencyStore {
+	return &CacheIdempotencyStore{store: store}
+}
+
+// Lock method
+func (s *CacheIdempotencyStore) Lock(key string, rec IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	// the stored record may expire between the add and the get, the add is tried again then
+	for i := 0; i < 2; i++ {
+		err := s.store.Add(key, rec, ttl)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, persistence.ErrNotStored) {
+			return nil, err
+		}
+		var stored IdempotencyRecord
+		err = s.store.Get(key, &stored)
+		if errors.Is(err, persistence.ErrCacheMiss) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &stored, nil
+	}
+
+	return nil, errIdempotencyContended
+}
+
+// Save method
+func (s *CacheIdempotencyStore) Save(key string, rec IdempotencyRecord, ttl time.Duration) error {
+	return s.store.Set(key, rec, ttl)
+}
+
+// Release method
+func (s *CacheIdempotencyStore) Release(key string) error {
+	err := s.store.Delete(key)
+	if errors.Is(err, persistence.ErrCacheMiss) {
+		return nil
+	}
+
+	return err
+}
+
+// RedisIdempotencyStore struct keeps the records in redis as JSON, the lock is a SET NX
+type RedisIdempotencyStore struct {
+	pool *redis.Pool
+}
+
+// NewRedisIdempotencyStore function, the pool is usually cache.RdPool of a redisResources name
+func NewRedisIdempotencyStore(pool *redis.Pool) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{pool: pool}
+}
+
+// Lock method
+func (s *RedisIdempotencyStore) Lock(key string, rec IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		_, err := redis.String(conn.Do("SET", key, b, "NX", "PX", ttl.Milliseconds()))
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, redis.ErrNil) {
+			return nil, err
+		}
+		v, err := redis.Bytes(conn.Do("GET", key))
+		if errors.Is(err, redis.ErrNil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var stored IdempotencyRecord
+		if err := json.Unmarshal(v, &stored); err != nil {
+			return nil, err
+		}
+		return &stored, nil
+	}
+
+	return nil, errIdempotencyContended
+}
+
+// Save method
+func (s *RedisIdempotencyStore) Save(key string, rec IdempotencyRecord, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("SET", key, b, "PX", ttl.Milliseconds())
+
+	return err
+}
+
+// Release method
+func (s *RedisIdempotencyStore) Release(key string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", key)
+
+	return err
+}
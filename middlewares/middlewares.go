@@ -24,7 +24,6 @@ import (
 	"github.com/jasacloud/go-libraries/db"
 	"github.com/jasacloud/go-libraries/server"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
@@ -232,12 +231,7 @@ func Auth(opt server.JwtOption) gin.HandlerFunc {
 		token, err := request.ParseFromRequest(c.Request, request.OAuth2Extractor, func(token *jwt.Token) (interface{}, error) {
 			var b interface{}
 			if (strings.HasPrefix(token.Method.Alg(), "RS") || strings.HasPrefix(token.Method.Alg(), "PS")) && opt.PublicKey != "" {
-				if server.PublicKey[opt.PublicKey] == nil {
-					server.PublicKey[opt.PublicKey], _ = ioutil.ReadFile(opt.PublicKey)
-					b, _ = jwt.ParseRSAPublicKeyFromPEM(server.PublicKey[opt.PublicKey].([]byte))
-				} else {
-					b, _ = jwt.ParseRSAPublicKeyFromPEM(server.PublicKey[opt.PublicKey].([]byte))
-				}
+				b, _ = jwt.ParseRSAPublicKeyFromPEM(server.JwtPublicKey(opt.PublicKey))
 			} else {
 				b = ([]byte(opt.Secret))
 			}
@@ -301,12 +295,7 @@ func CreateToken(opt server.JwtOption, claims jwt.MapClaims) string {
 	allgoritm := opt.Algorithm
 	var key interface{}
 	if (strings.HasPrefix(allgoritm, "RS") || strings.HasPrefix(allgoritm, "PS")) && opt.PrivateKey != "" {
-		if server.PrivateKey[opt.PrivateKey] == nil {
-			server.PrivateKey[opt.PrivateKey], _ = ioutil.ReadFile(opt.PrivateKey)
-			key, _ = jwt.ParseRSAPrivateKeyFromPEM(server.PrivateKey[opt.PrivateKey].([]byte))
-		} else {
-			key, _ = jwt.ParseRSAPrivateKeyFromPEM(server.PrivateKey[opt.PrivateKey].([]byte))
-		}
+		key, _ = jwt.ParseRSAPrivateKeyFromPEM(server.JwtPrivateKey(opt.PrivateKey))
 	} else {
 		key = []byte(opt.Secret)
 	}
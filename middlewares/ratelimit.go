@@ -0,0 +1,408 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gomodule/redigo/redis"
+	"github.com/jasacloud/go-libraries/cache"
+	"github.com/jasacloud/go-libraries/helper"
+	"github.com/jasacloud/go-libraries/server"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenBucket constant is the rate limit algorithm refilling Limit tokens per period up to Burst
+	TokenBucket string = "tokenBucket"
+	// SlidingWindow constant is the rate limit algorithm allowing Limit requests in any period long window
+	SlidingWindow string = "slidingWindow"
+)
+
+// RateLimitOption struct
+type RateLimitOption struct {
+	// Name prefixes the keys of the limiter, limiters sharing a store must have distinct names
+	Name      string `json:"name" bson:"name"`
+	Algorithm string `json:"algorithm" bson:"algorithm" validate:"omitempty,oneof=tokenBucket slidingWindow"`
+	Limit     int    `json:"limit" bson:"limit" validate:"min=1"`
+	PeriodSec int    `json:"periodSec" bson:"periodSec" validate:"min=1"`
+	// Burst is the bucket capacity of the token bucket, default to Limit
+	Burst int `json:"burst" bson:"burst" validate:"min=0"`
+	// Key is "ip" (default), "credential", "claim:<name>", e.g. "claim:client_id",
+	// or "header:<name>", e.g. "header:X-API-Key"
+	Key string `json:"key" bson:"key"`
+	// Store is "memory" (default) or "redis:<redisResources name>"
+	Store string `json:"store" bson:"store"`
+}
+
+// RateLimitResult struct
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimitStore interface keeps the state of the limiters
+type RateLimitStore interface {
+	Take(key string, opt RateLimitOption) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc type returns the key of the client of the request
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// KeyByIP function keys the clients by their IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByClaim function keys the clients by a claim of their token set by Auth or AuthServer,
+// e.g. client_id of apiv3.Claims. Requests without the claim are keyed by IP.
+func KeyByClaim(name string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		if v, ok := c.Get("jwt_" + name); ok {
+			return "claim:" + name + ":" + claimString(v)
+		}
+		var claims map[string]interface{}
+		switch v := c.Value("claims").(type) {
+		case jwt.MapClaims:
+			claims = v
+		case map[string]interface{}:
+			claims = v
+		}
+		if v, ok := claims[name]; ok && v != nil {
+			return "claim:" + name + ":" + claimString(v)
+		}
+
+		return KeyByIP(c)
+	}
+}
+
+// KeyByHeader function keys the clients by the sha256 of a request header, e.g. an API key,
+// so the value is not stored in the key names. Requests without the header are keyed by IP.
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		if v := c.GetHeader(name); v != "" {
+			sum := sha256.Sum256([]byte(v))
+			return "header:" + strings.ToLower(name) + ":" + hex.EncodeToString(sum[:])
+		}
+
+		return KeyByIP(c)
+	}
+}
+
+// KeyByCredential function keys the clients by the sha256 of their credential, the Authorization header
+// or the access_token query parameter read by Auth. Requests without a credential are keyed by IP.
+func KeyByCredential(c *gin.Context) string {
+	v := c.GetHeader("Authorization")
+	if v == "" {
+		v = c.Query("access_token")
+	}
+	if v != "" {
+		sum := sha256.Sum256([]byte(v))
+		return "credential:" + hex.EncodeToString(sum[:])
+	}
+
+	return KeyByIP(c)
+}
+
+// claimString function
+func claimString(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// keyFunc method
+func (o RateLimitOption) keyFunc() (RateLimitKeyFunc, error) {
+	return keyFuncOf(o.Key)
+}
+
+// keyFuncOf function returns the key function of the spec, "ip" (default), "claim:<name>" or "header:<name>"
+func keyFuncOf(spec string) (RateLimitKeyFunc, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "" || kind == "ip":
+		return KeyByIP, nil
+	case kind == "credential":
+		return KeyByCredential, nil
+	case kind == "claim" && name != "":
+		return KeyByClaim(name), nil
+	case kind == "header" && name != "":
+		return KeyByHeader(name), nil
+	}
+
+	return nil, fmt.Errorf("invalid client key %q", spec)
+}
+
+// period method
+func (o RateLimitOption) period() time.Duration {
+	return time.Duration(o.PeriodSec) * time.Second
+}
+
+// burst method
+func (o RateLimitOption) burst() int {
+	if o.Burst > 0 {
+		return o.Burst
+	}
+
+	return o.Limit
+}
+
+// RateLimit function returns a middleware limiting the requests of each client as configured by opt.
+// The store defaults to the store of opt.Store. Limited requests are answered with status 429,
+// a Retry-After header and the returnval/error envelope. Requests are allowed when the store fails.
+func RateLimit(opt RateLimitOption, store ...RateLimitStore) gin.HandlerFunc {
+	if err := helper.ValidateStructJSON(opt); err != nil {
+		log.Fatalf("rate limit %s: %v", opt.Name, err)
+	}
+	key, err := opt.keyFunc()
+	if err != nil {
+		log.Fatalf("rate limit %s: %v", opt.Name, err)
+	}
+	var s RateLimitStore
+	if len(store) > 0 && store[0] != nil {
+		s = store[0]
+	} else if s, err = NewRateLimitStore(opt.Store); err != nil {
+		log.Fatalf("rate limit %s: %v", opt.Name, err)
+	}
+	prefix := "ratelimit:" + opt.Name + ":"
+
+	return func(c *gin.Context) {
+		r, err := s.Take(prefix+key(c), opt)
+		if err != nil {
+			log.Println("Rate limit error:", err)
+			c.Next()
+			return
+		}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(opt.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(r.Remaining))
+		if !r.Allowed {
+			retry := int(math.Ceil(r.RetryAfter.Seconds()))
+			if retry < 1 {
+				retry = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retry))
+			body := server.ErrorResponse("429", "Too Many Requests", c)
+			body["type"] = "RateLimit"
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"returnval": false,
+				"error":     body,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// NewRateLimitStore function returns the store of the spec, "memory" or "redis:<redisResources name>"
+func NewRateLimitStore(spec string) (RateLimitStore, error) {
+	kind, name, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "" || kind == "memory":
+		return NewMemoryRateLimitStore(), nil
+	case kind == "redis" && name != "":
+		if cache.GetRedisResource(name).Host == "" {
+			return nil, fmt.Errorf("redis resource %q not found", name)
+		}
+		// the pool is the one of the cache.RdConnect store of the resource
+		return NewRedisRateLimitStore(cache.RdPool(name)), nil
+	}
+
+	return nil, fmt.Errorf("invalid rate limit store %q", spec)
+}
+
+// memoryEntry struct
+type memoryEntry struct {
+	tokens float64
+	last   time.Time
+	window int64
+	count  int
+	prev   int
+	expire time.Time
+}
+
+// MemoryRateLimitStore struct keeps the limiters in the process, for single instance services
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	sweep   time.Time
+}
+
+// NewMemoryRateLimitStore function
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{entries: make(map[string]*memoryEntry)}
+}
+
+// Take method
+func (m *MemoryRateLimitStore) Take(key string, opt RateLimitOption) (RateLimitResult, error) {
+	now := time.Now()
+	period := opt.period()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.After(m.sweep) {
+		for k, e := range m.entries {
+			if now.After(e.expire) {
+				delete(m.entries, k)
+			}
+		}
+		m.sweep = now.Add(period)
+	}
+	e := m.entries[key]
+	if e == nil {
+		e = &memoryEntry{tokens: float64(opt.burst()), last: now}
+		m.entries[key] = e
+	}
+	e.expire = now.Add(2 * period)
+
+	if opt.Algorithm == SlidingWindow {
+		window := now.UnixNano() / int64(period)
+		switch {
+		case window == e.window+1:
+			e.prev, e.count = e.count, 0
+		case window != e.window:
+			e.prev, e.count = 0, 0
+		}
+		e.window = window
+		elapsed := time.Duration(now.UnixNano() - window*int64(period))
+		r := slidingWindow(opt.Limit, e.prev, e.count, elapsed, period)
+		if r.Allowed {
+			e.count++
+		}
+		return r, nil
+	}
+
+	burst := float64(opt.burst())
+	rate := float64(opt.Limit) / float64(period)
+	e.tokens = math.Min(burst, e.tokens+float64(now.Sub(e.last))*rate)
+	e.last = now
+	if e.tokens >= 1 {
+		e.tokens--
+		return RateLimitResult{Allowed: true, Remaining: int(e.tokens)}, nil
+	}
+
+	return RateLimitResult{RetryAfter: time.Duration((1 - e.tokens) / rate)}, nil
+}
+
+// slidingWindow function weights the count of the previous window by its part still in the sliding window
+func slidingWindow(limit, prev, count int, elapsed, period time.Duration) RateLimitResult {
+	weighted := float64(prev)*float64(period-elapsed)/float64(period) + float64(count)
+	if weighted+1 <= float64(limit) {
+		return RateLimitResult{Allowed: true, Remaining: int(float64(limit) - weighted - 1)}
+	}
+	retry := period - elapsed
+	if count < limit && prev > 0 {
+		// the previous window slides out until there is room for one more request
+		retry = time.Duration(float64(period)*(1-float64(limit-count-1)/float64(prev))) - elapsed
+	}
+
+	return RateLimitResult{RetryAfter: retry}
+}
+
+// tokenBucketScript keeps the bucket in a hash, ARGV: burst, tokens per ms, now in ms, ttl in ms
+var tokenBucketScript = redis.NewScript(1, `
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', KEYS[1], 't', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, math.floor(tokens), wait}
+`)
+
+// slidingWindowScript counts the requests of the current and previous windows, ARGV: limit, period in ms, now in ms
+var slidingWindowScript = redis.NewScript(1, `
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local window = math.floor(now / period)
+local cur = KEYS[1] .. ':' .. window
+local prev = tonumber(redis.call('GET', KEYS[1] .. ':' .. (window - 1)) or '0')
+local count = tonumber(redis.call('GET', cur) or '0')
+local elapsed = now - window * period
+local weighted = prev * (period - elapsed) / period + count
+if weighted + 1 > limit then
+	local wait = period - elapsed
+	if count < limit and prev > 0 then
+		wait = math.ceil(period * (1 - (limit - count - 1) / prev)) - elapsed
+	end
+	return {0, 0, wait}
+end
+redis.call('INCR', cur)
+redis.call('PEXPIRE', cur, period * 2)
+return {1, math.floor(limit - weighted - 1), 0}
+`)
+
+// RedisRateLimitStore struct keeps the limiters in redis, shared by every instance of the service
+type RedisRateLimitStore struct {
+	pool *redis.Pool
+}
+
+// NewRedisRateLimitStore function, the pool is usually cache.RdPool of a redisResources name,
+// shared with the cache.RdConnect store of the resource. The store needs the pool for its scripts.
+func NewRedisRateLimitStore(pool *redis.Pool) *RedisRateLimitStore {
+	return &RedisRateLimitStore{pool: pool}
+}
+
+// Take method
+func (s *RedisRateLimitStore) Take(key string, opt RateLimitOption) (RateLimitResult, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().UnixMilli()
+	period := opt.period().Milliseconds()
+	var reply []int64
+	var err error
+	if opt.Algorithm == SlidingWindow {
+		// the hash tag keeps both windows of the key in the same cluster slot
+		reply, err = redis.Int64s(slidingWindowScript.Do(conn, "{"+key+"}", opt.Limit, period, now))
+	} else {
+		rate := float64(opt.Limit) / float64(period)
+		reply, err = redis.Int64s(tokenBucketScript.Do(conn, key, opt.burst(), strconv.FormatFloat(rate, 'f', -1, 64), now, 2*period))
+	}
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(reply) != 3 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+
+	return RateLimitResult{
+		Allowed:    reply[0] == 1,
+		Remaining:  int(reply[1]),
+		RetryAfter: time.Duration(reply[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,387 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package openapi generates the OpenAPI 3 document of the routes of a gin engine. Every registered route
+// is listed, Doc adds the summary and the request and response types of a route:
+//
+//	openapi.Doc("POST", "/v1/users", openapi.Route{
+//		Summary:  "Create a user",
+//		Request:  openapi.Envelope{Kind: "user", Values: CreateUser{}},
+//		Response: openapi.Envelope{Kind: "user", Values: User{}},
+//		Auth:     true,
+//	})
+//
+// The schemas are built from the json tags, the binding and validate tags give the required fields
+// and the constraints, e.g. min, max, len, oneof and email.
+package openapi
+
+import (
+	"embed"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Version constant is the OpenAPI version of the generated documents
+const Version string = "3.0.3"
+
+// SwaggerUiURL variable is the base URL of the swagger-ui-dist assets loaded by the Swagger UI page,
+// empty to load the embedded swagger-ui 4.15.5 assets served by AssetsHandler next to the page
+var SwaggerUiURL = ""
+
+// uiAssets is the swagger-ui.css and the swagger-ui-bundle.js of swagger-ui 4.15.5
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var uiAssets embed.FS
+
+// Route struct documents a route
+type Route struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Query is a struct value documenting the query parameters by its form tags
+	Query interface{}
+	// Request is a value of the type of the request body, or an Envelope for the apiv3 request envelope
+	Request interface{}
+	// Response is a value of the type of the response body, or an Envelope for the apiv3 response envelope
+	Response interface{}
+	// Auth documents the bearer JWT checked by middlewares.Auth
+	Auth       bool
+	Deprecated bool
+}
+
+// Envelope struct documents the apiv3 Request or Response envelope of the kind,
+// Values is a value of the type of its values, e.g. apiv3.Params{}
+type Envelope struct {
+	Kind   string
+	Values interface{}
+}
+
+// Info struct
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server struct
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Document struct is the OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// PathItem type holds the operations of a path by lower case method
+type PathItem map[string]*Operation
+
+// Operation struct
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+// Parameter struct
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody struct
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response struct
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType struct
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components struct
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme struct
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+var (
+	docsMu sync.RWMutex
+	docs   = make(map[string]Route)
+	hidden = make(map[string]bool)
+)
+
+// Doc function documents the route of the method and gin path, e.g. Doc("GET", "/v1/users/:id", Route{...})
+func Doc(method, path string, route Route) {
+	docsMu.Lock()
+	defer docsMu.Unlock()
+	docs[strings.ToUpper(method)+" "+path] = route
+}
+
+// Hide function leaves the route of the method and gin path out of the documents, "*" hides every method
+func Hide(method, path string) {
+	docsMu.Lock()
+	defer docsMu.Unlock()
+	hidden[strings.ToUpper(method)+" "+path] = true
+}
+
+// isHidden function
+func isHidden(method, path string) bool {
+	return hidden[method+" "+path] || hidden["* "+path]
+}
+
+// ginParam matches the :name and *name segments of the gin paths
+var ginParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+// Generate function returns the document of the routes of the engine
+func Generate(engine *gin.Engine, info Info, servers ...Server) *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Servers: servers,
+		Paths:   make(map[string]PathItem),
+	}
+
+	docsMu.RLock()
+	defer docsMu.RUnlock()
+	auth := false
+	for _, r := range engine.Routes() {
+		if isHidden(r.Method, r.Path) {
+			continue
+		}
+		route := docs[r.Method+" "+r.Path]
+		op := g.operation(r.Method, r.Path, route)
+		if route.Auth {
+			op.Security = []map[string][]string{{"bearerAuth": {}}}
+			auth = true
+		}
+		path := ginParam.ReplaceAllString(r.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+
+	doc.Components.Schemas = g.schemas
+	if auth {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+		}
+	}
+
+	return doc
+}
+
+// operation method
+func (g *generator) operation(method, path string, route Route) *Operation {
+	op := &Operation{
+		Tags:        route.Tags,
+		Summary:     route.Summary,
+		Description: route.Description,
+		OperationID: operationID(method, path),
+		Deprecated:  route.Deprecated,
+		Responses:   map[string]*Response{},
+	}
+	for _, m := range ginParam.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     m[1],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	if route.Query != nil {
+		op.Parameters = append(op.Parameters, g.queryParameters(route.Query)...)
+	}
+	if route.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  jsonContent(g.body(route.Request, false)),
+		}
+	}
+	resp := &Response{Description: "OK"}
+	if route.Response != nil {
+		resp.Content = jsonContent(g.body(route.Response, true))
+	}
+	op.Responses["200"] = resp
+
+	return op
+}
+
+// body method returns the schema of the request or response body
+func (g *generator) body(v interface{}, response bool) *Schema {
+	e, ok := v.(Envelope)
+	if !ok {
+		return g.schemaOf(v)
+	}
+	kind := &Schema{Type: "string"}
+	if e.Kind != "" {
+		kind.Enum = []interface{}{e.Kind}
+	}
+	values := &Schema{}
+	if e.Values != nil {
+		values = g.schemaOf(e.Values)
+	}
+	if !response {
+		return &Schema{
+			Type:     "object",
+			Required: []string{"kind", "values"},
+			Properties: map[string]*Schema{
+				"kind":   kind,
+				"values": values,
+			},
+		}
+	}
+
+	return &Schema{
+		Type:     "object",
+		Required: []string{"returnval"},
+		Properties: map[string]*Schema{
+			"returnval": {Type: "boolean"},
+			"respval":   {Type: "string"},
+			"kind":      kind,
+			"values":    values,
+			"error":     g.errorSchema(),
+		},
+	}
+}
+
+// errorSchema method returns the reference of the error of the envelope
+func (g *generator) errorSchema() *Schema {
+	if _, ok := g.schemas["Error"]; !ok {
+		s := &Schema{Type: "string"}
+		g.schemas["Error"] = &Schema{
+			Type:     "object",
+			Required: []string{"code"},
+			Properties: map[string]*Schema{
+				"code":            s,
+				"type":            s,
+				"status":          s,
+				"message":         s,
+				"message_details": s,
+				"request_id":      s,
+				"trace_id":        s,
+			},
+		}
+	}
+
+	return &Schema{Ref: "#/components/schemas/Error"}
+}
+
+// jsonContent function
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+// operationID function returns e.g. "get_v1_users_id" for GET /v1/users/:id
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, p := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		id += "_" + p
+	}
+
+	return id
+}
+
+// Handler function serves the document of the routes of the engine, generated on each request
+func Handler(engine *gin.Engine, info Info, servers ...Server) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, Generate(engine, info, servers...))
+	}
+}
+
+// swaggerUi is the Swagger UI page of the document
+var swaggerUi = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Assets}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}/swagger-ui-bundle.js" crossorigin></script>
+<script>
+window.onload = function() {
+	window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+};
+</script>
+</body>
+</html>
+`))
+
+// UiHandler function serves the Swagger UI page of the document served on specURL
+func UiHandler(title, specURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		assets := SwaggerUiURL
+		if assets == "" {
+			assets = strings.TrimSuffix(c.Request.URL.Path, "/") + "/assets"
+		}
+		err := swaggerUi.Execute(c.Writer, map[string]string{
+			"Title":   title,
+			"Assets":  assets,
+			"SpecURL": specURL,
+		})
+		if err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// AssetsHandler function serves the embedded Swagger UI assets of the *file param,
+// mount it on the path of the page followed by /assets/*file
+func AssetsHandler() gin.HandlerFunc {
+	assets, _ := fs.Sub(uiAssets, "swagger-ui")
+	return func(c *gin.Context) {
+		c.FileFromFS(c.Param("file"), http.FS(assets))
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema struct is the OpenAPI schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     bool               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     bool               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// componentName replaces the characters not allowed in the component names, e.g. of generic types
+	componentName = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+	// oneofValues splits the oneof param like the validator, quoted values may contain spaces
+	oneofValues = regexp.MustCompile(`'[^']*'|\S+`)
+)
+
+// generator struct builds the schemas of a document, named structs are components
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// newGenerator function
+func newGenerator() *generator {
+	return &generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+// schemaOf method
+func (g *generator) schemaOf(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+
+	return g.schema(reflect.TypeOf(v))
+}
+
+// schema method
+func (g *generator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Kind() != reflect.Struct && (t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)):
+		return &Schema{Type: "string"}
+	case t.Kind() != reflect.Struct && (t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType)):
+		// e.g. bson.ObjectID, an array marshaled as its hex string
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.component(t)
+	default:
+		return &Schema{}
+	}
+}
+
+// component method returns the reference of the named struct, building its schema once
+func (g *generator) component(t reflect.Type) *Schema {
+	name, ok := g.names[t]
+	if !ok {
+		base := componentName.ReplaceAllString(path.Base(t.PkgPath())+"."+t.Name(), "_")
+		name = base
+		for i := 2; g.schemas[name] != nil; i++ {
+			name = base + strconv.Itoa(i)
+		}
+		g.names[t] = name
+		// registered before building for the recursive types
+		g.schemas[name] = &Schema{}
+		*g.schemas[name] = *g.object(t)
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// object method returns the schema of the struct, the embedded structs without json name are inlined
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	if len(s.Properties) == 0 {
+		s.Properties = nil
+	}
+
+	return s
+}
+
+// fields method
+func (g *generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, s)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var fs *Schema
+		if strings.Contains(","+opts+",", ",string,") {
+			fs = &Schema{Type: "string"}
+		} else {
+			fs = g.schema(f.Type)
+		}
+		if fs.Ref == "" {
+			fs.Description = f.Tag.Get("description")
+		}
+		if constrain(fs, f.Tag) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+}
+
+// queryParameters method returns the query parameters of the struct by its form tags
+func (g *generator) queryParameters(v interface{}) []Parameter {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		params = append(params, Parameter{
+			Name:        name,
+			In:          "query",
+			Description: f.Tag.Get("description"),
+			Required:    constrain(s, f.Tag),
+			Schema:      s,
+		})
+	}
+
+	return params
+}
+
+// constrain function applies the binding and validate rules of the field to its schema,
+// it reports whether the field is required. The rules after dive are the rules of the elements.
+func constrain(s *Schema, tag reflect.StructTag) bool {
+	required := false
+	for _, rules := range []string{tag.Get("binding"), tag.Get("validate")} {
+		for _, rule := range strings.Split(rules, ",") {
+			if rule == "dive" {
+				break
+			}
+			name, param, _ := strings.Cut(rule, "=")
+			if name == "required" {
+				required = true
+				continue
+			}
+			if s.Ref != "" {
+				// the siblings of a reference are ignored
+				continue
+			}
+			applyRule(s, name, param)
+		}
+	}
+
+	return required
+}
+
+// applyRule function
+func applyRule(s *Schema, name, param string) {
+	switch name {
+	case "min", "gte", "gt":
+		bound(s, param, true, name == "gt")
+	case "max", "lte", "lt":
+		bound(s, param, false, name == "lt")
+	case "len":
+		bound(s, param, true, false)
+		bound(s, param, false, false)
+	case "oneof":
+		s.Enum = nil
+		for _, v := range oneofValues.FindAllString(param, -1) {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && (s.Type == "integer" || s.Type == "number") {
+				s.Enum = append(s.Enum, f)
+			} else {
+				s.Enum = append(s.Enum, strings.Trim(v, "'"))
+			}
+		}
+	case "email":
+		s.Format = "email"
+	case "url", "uri", "http_url":
+		s.Format = "uri"
+	case "uuid", "uuid4", "uuid_rfc4122", "uuid4_rfc4122":
+		s.Format = "uuid"
+	case "ipv4":
+		s.Format = "ipv4"
+	case "ipv6":
+		s.Format = "ipv6"
+	case "datetime":
+		s.Format = "date-time"
+	}
+}
+
+// bound function sets the minimum or maximum of the numbers, the length of the strings
+// or the number of items of the arrays
+func bound(s *Schema, param string, lower, exclusive bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	switch s.Type {
+	case "integer", "number":
+		if lower {
+			s.Minimum, s.ExclusiveMinimum = &n, exclusive
+		} else {
+			s.Maximum, s.ExclusiveMaximum = &n, exclusive
+		}
+		return
+	}
+	i := int(n)
+	if exclusive {
+		if lower {
+			i++
+		} else {
+			i--
+		}
+	}
+	switch s.Type {
+	case "string":
+		if lower {
+			s.MinLength = &i
+		} else {
+			s.MaxLength = &i
+		}
+	case "array":
+		if lower {
+			s.MinItems = &i
+		} else {
+			s.MaxItems = &i
+		}
+	}
+}
@@ -14,6 +14,7 @@
 package serial
 
 import (
+	"errors"
 	"github.com/jasacloud/go-libraries/config"
 	"github.com/tarm/serial"
 	"log"
@@ -26,13 +27,17 @@ type SerialConf struct {
 
 // SerialOption struct
 type SerialOption struct {
-	Name    string `json:"name" bson:"name"`
-	ComName string `json:"comName" bson:"comName"`
-	Baud    int    `json:"baud" bson:"baud"`
+	Name    string `json:"name" bson:"name" validate:"required"`
+	ComName string `json:"comName" bson:"comName" validate:"required"`
+	Baud    int    `json:"baud" bson:"baud" validate:"min=0"`
+}
+
+func init() {
+	config.RegisterResources("serialResources", SerialOption{})
 }
 
 var (
-	// Serial variable
+	// Serial variable is not updated anymore, use GetSerialResource which reads the current config
 	Serial SerialConf
 )
 
@@ -41,17 +46,12 @@ var SerialConn = make(map[string]*serial.Port)
 
 // GetSerialResource function
 func GetSerialResource(resourceName string) SerialOption {
-
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Serial)
-	for _, v := range Serial.SerialOption {
-		if v.Name == resourceName {
-
-			return v
-		}
+	r, err := config.Resource[SerialOption]("serialResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load serial resource "+resourceName+", error: ", err)
 	}
 
-	return SerialOption{}
+	return r
 }
 
 // SerialConnect function
@@ -0,0 +1,204 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/config"
+	"github.com/jasacloud/go-libraries/logger"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AccessLogOptions is option of access log that defined from config.
+// Format is "json" (default) or "combined" (Apache combined log format). Output is "stdout" (default),
+// "stderr" or a daily rotated file. SampleRate between 0 and 1 logs that part of the requests,
+// 0 logs every request, error responses are always logged. ExcludePaths are exact paths
+// or prefixes ending with "*", e.g. "/healthz" or "/static/*".
+type AccessLogOptions struct {
+	Enable       bool     `json:"enable" bson:"enable"`
+	Format       string   `json:"format" bson:"format" validate:"omitempty,oneof=json combined"`
+	Output       string   `json:"output" bson:"output"`
+	SampleRate   float64  `json:"sampleRate" bson:"sampleRate" validate:"min=0,max=1"`
+	ExcludePaths []string `json:"excludePaths" bson:"excludePaths"`
+}
+
+// AccessLogConf struct
+type AccessLogConf struct {
+	AccessLog AccessLogOptions `json:"accessLog" bson:"accessLog"`
+}
+
+// AccessRecord struct is the access log record of a request
+type AccessRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	LatencyMs float64   `json:"latencyMs"`
+	Bytes     int       `json:"bytes"`
+	ClientIp  string    `json:"clientIp"`
+	RequestId string    `json:"requestId,omitempty"`
+	TraceId   string    `json:"traceId,omitempty"`
+	Sub       string    `json:"sub,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Referer   string    `json:"referer,omitempty"`
+}
+
+// accessLogger struct
+type accessLogger struct {
+	options AccessLogOptions
+	writer  io.Writer
+}
+
+var (
+	// AccessLog variable
+	AccessLog AccessLogConf
+
+	// accessLog variable holds the logger built from the current access log options
+	accessLog atomic.Value
+
+	accessWritersMu sync.Mutex
+	accessWriters   = make(map[string]io.Writer)
+)
+
+// AccessLogHandler function returns the access log middleware, it logs once the request is handled
+func AccessLogHandler() gin.HandlerFunc {
+	storeAccessLog(AccessLog.AccessLog)
+	return currentAccessLogHandler
+}
+
+// storeAccessLog function
+func storeAccessLog(options AccessLogOptions) {
+	l := &accessLogger{options: options}
+	if options.Enable {
+		w, err := accessWriter(options.Output)
+		if err != nil {
+			log.Printf("failed open access log %s: %v", options.Output, err)
+			return
+		}
+		l.writer = w
+	}
+	accessLog.Store(l)
+}
+
+// currentAccessLogHandler function
+func currentAccessLogHandler(c *gin.Context) {
+	l, ok := accessLog.Load().(*accessLogger)
+	if !ok || !l.options.Enable || l.excluded(c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+	start := time.Now()
+	c.Next()
+
+	status := c.Writer.Status()
+	if status < 400 && l.options.SampleRate > 0 && rand.Float64() >= l.options.SampleRate {
+		return
+	}
+	bytes := c.Writer.Size()
+	if bytes < 0 {
+		bytes = 0
+	}
+	r := AccessRecord{
+		Time:      start,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Query:     c.Request.URL.RawQuery,
+		Proto:     c.Request.Proto,
+		Status:    status,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Bytes:     bytes,
+		ClientIp:  c.ClientIP(),
+		RequestId: c.GetString(RequestIDKey),
+		Sub:       c.GetString("jwt_sub"),
+		UserAgent: c.Request.UserAgent(),
+		Referer:   c.Request.Referer(),
+	}
+	if t, ok := GetTrace(c); ok {
+		r.TraceId = t.TraceID
+	}
+	if _, err := l.writer.Write(l.format(r)); err != nil {
+		log.Printf("failed write access log: %v", err)
+	}
+}
+
+// excluded method
+func (l *accessLogger) excluded(p string) bool {
+	return pathMatches(l.options.ExcludePaths, p)
+}
+
+// format method returns the record as a line of the configured format
+func (l *accessLogger) format(r AccessRecord) []byte {
+	if l.options.Format == "combined" {
+		target := r.Path
+		if r.Query != "" {
+			target += "?" + r.Query
+		}
+		return []byte(fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %q %q\n",
+			r.ClientIp, dash(r.Sub), r.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method, target, r.Proto, r.Status, r.Bytes, dash(r.Referer), dash(r.UserAgent)))
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return []byte(fmt.Sprintf("{\"error\":%q}\n", err.Error()))
+	}
+
+	return append(b, '\n')
+}
+
+// dash function
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// accessWriter function returns the writer of the output, files are opened once
+func accessWriter(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	accessWritersMu.Lock()
+	defer accessWritersMu.Unlock()
+	if w, ok := accessWriters[output]; ok {
+		return w, nil
+	}
+	file := output
+	if runtime.GOOS == "windows" {
+		file = path.Join(config.GetConfigDir(), file)
+	}
+	w, err := logger.NewRawLogFile(file)
+	if err != nil {
+		return nil, err
+	}
+	accessWriters[output] = w
+
+	return w, nil
+}
@@ -0,0 +1,536 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"hash/fnv"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// DefaultCompressMinSize constant is the size from which the responses are compressed
+	DefaultCompressMinSize int = 1024
+	// DefaultETagMaxSize constant is the size up to which the responses are buffered for their ETag
+	DefaultETagMaxSize int = 1 << 20
+)
+
+var (
+	// DefaultCompressEncodings variable is the preference order of the encodings
+	DefaultCompressEncodings = []string{"br", "zstd", "gzip"}
+	// DefaultCompressMimeTypes variable, a type ending with "*" is a prefix
+	DefaultCompressMimeTypes = []string{"text/*", "application/json", "application/*+json", "application/xml",
+		"application/javascript", "application/problem+json", "image/svg+xml"}
+	// DefaultETagMimeTypes variable
+	DefaultETagMimeTypes = []string{"application/json", "application/*+json"}
+)
+
+// CompressOptions is option of response compression and ETag that defined from config.
+// Encodings are the accepted encodings by preference order, br, zstd and gzip by default.
+// The responses of MimeTypes from MinSize bytes are compressed, ExcludePaths are exact paths
+// or prefixes ending with "*". ETag adds a weak ETag to the successful GET responses of
+// ETagMimeTypes up to ETagMaxSize bytes and answers a matching If-None-Match with 304.
+type CompressOptions struct {
+	Enable        bool     `json:"enable" bson:"enable"`
+	Encodings     []string `json:"encodings" bson:"encodings" validate:"dive,oneof=br zstd gzip"`
+	MinSize       int      `json:"minSize" bson:"minSize" validate:"min=0"`
+	MimeTypes     []string `json:"mimeTypes" bson:"mimeTypes"`
+	ExcludePaths  []string `json:"excludePaths" bson:"excludePaths"`
+	ETag          bool     `json:"etag" bson:"etag"`
+	ETagMimeTypes []string `json:"etagMimeTypes" bson:"etagMimeTypes"`
+	ETagMaxSize   int      `json:"etagMaxSize" bson:"etagMaxSize" validate:"min=0"`
+}
+
+// CompressConf struct
+type CompressConf struct {
+	Compress CompressOptions `json:"compression" bson:"compression"`
+}
+
+var (
+	// Compress variable
+	Compress CompressConf
+
+	// compressOptions variable holds the current *CompressOptions
+	compressOptions atomic.Value
+)
+
+// CompressHandler function returns the compression and ETag middleware of the compression section
+func CompressHandler() gin.HandlerFunc {
+	storeCompress(Compress.Compress)
+	return currentCompressHandler
+}
+
+// storeCompress function fills the defaults of the options and makes them current
+func storeCompress(o CompressOptions) {
+	if len(o.Encodings) == 0 {
+		o.Encodings = DefaultCompressEncodings
+	}
+	if o.MinSize == 0 {
+		o.MinSize = DefaultCompressMinSize
+	}
+	if len(o.MimeTypes) == 0 {
+		o.MimeTypes = DefaultCompressMimeTypes
+	}
+	if len(o.ETagMimeTypes) == 0 {
+		o.ETagMimeTypes = DefaultETagMimeTypes
+	}
+	if o.ETagMaxSize == 0 {
+		o.ETagMaxSize = DefaultETagMaxSize
+	}
+	compressOptions.Store(&o)
+}
+
+// currentCompressHandler function
+func currentCompressHandler(c *gin.Context) {
+	o, ok := compressOptions.Load().(*CompressOptions)
+	if !ok || !o.Enable || pathMatches(o.ExcludePaths, c.Request.URL.Path) {
+		c.Next()
+		return
+	}
+	writer := c.Writer
+	defer func() {
+		c.Writer = writer
+	}()
+
+	var cw *compressWriter
+	if encoding := acceptEncoding(c.GetHeader("Accept-Encoding"), o.Encodings); encoding != "" {
+		cw = &compressWriter{ResponseWriter: c.Writer, options: o, encoding: encoding, head: c.Request.Method == http.MethodHead}
+		c.Writer = cw
+	}
+	var ew *etagWriter
+	if o.ETag && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+		ew = &etagWriter{ResponseWriter: c.Writer, options: o, ifNoneMatch: c.GetHeader("If-None-Match")}
+		c.Writer = ew
+	}
+	c.Next()
+
+	if ew != nil {
+		ew.finish()
+	}
+	if cw != nil {
+		cw.finish()
+	}
+}
+
+// pathMatches function reports whether p is one of the paths or starts with a prefix ending with "*"
+func pathMatches(paths []string, p string) bool {
+	for _, e := range paths {
+		if prefix, ok := strings.CutSuffix(e, "*"); ok && strings.HasPrefix(p, prefix) {
+			return true
+		}
+		if e == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mimeMatches function
+func mimeMatches(types []string, contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, m := range types {
+		if m == t {
+			return true
+		}
+		// e.g. "text/*" or "application/*+json"
+		if prefix, suffix, ok := strings.Cut(m, "*"); ok && strings.HasPrefix(t, prefix) && strings.HasSuffix(t, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acceptEncoding function returns the encoding accepted with the highest quality,
+// the preference order of the encodings breaks the ties
+func acceptEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		quality[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+	best, bestQ := "", 0.0
+	for _, e := range encodings {
+		q, ok := quality[e]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter struct buffers the response until MinSize bytes to decide its compression,
+// a flush decides at once so the streamed responses are not held
+type compressWriter struct {
+	gin.ResponseWriter
+	options  *CompressOptions
+	encoding string
+	head     bool
+	status   int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	encoder  io.WriteCloser
+}
+
+// WriteHeader method
+func (w *compressWriter) WriteHeader(code int) {
+	if !w.decided && code > 0 {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// WriteHeaderNow method
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Status method
+func (w *compressWriter) Status() int {
+	if !w.decided && w.status != 0 {
+		return w.status
+	}
+
+	return w.ResponseWriter.Status()
+}
+
+// Written method
+func (w *compressWriter) Written() bool {
+	return w.decided && w.ResponseWriter.Written() || len(w.buf) > 0
+}
+
+// Write method
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.options.MinSize {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// WriteString method
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush method
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide()
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Hijack method
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.ResponseWriter.Hijack()
+}
+
+// Unwrap method lets http.ResponseController reach the connection, e.g. to clear the write deadline
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide method compresses the response when it is big enough and of an allowed type,
+// then writes the header and the buffered body
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	status := w.status
+	if status == 0 {
+		status = w.ResponseWriter.Status()
+	}
+	// a partial content is a range of the identity representation, it is never encoded
+	if len(w.buf) >= w.options.MinSize && status >= 200 && status != http.StatusNoContent &&
+		status != http.StatusPartialContent && status != http.StatusNotModified &&
+		h.Get("Content-Range") == "" && h.Get("Content-Encoding") == "" &&
+		mimeMatches(w.options.MimeTypes, h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			// the encoded representation differs from the one the strong ETag was computed on
+			h.Set("ETag", "W/"+etag)
+		}
+		w.encoder = newEncoder(w.encoding, w.ResponseWriter)
+	}
+	if h.Get("Content-Encoding") != "" || mimeMatches(w.options.MimeTypes, h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	w.ResponseWriter.WriteHeader(status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 || w.head {
+		w.ResponseWriter.WriteHeaderNow()
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+
+	return err
+}
+
+// finish method writes the small responses as they are and completes the encoded ones
+func (w *compressWriter) finish() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		_ = w.decide()
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		releaseEncoder(w.encoding, w.encoder)
+		w.encoder = nil
+	}
+}
+
+var (
+	gzipPool   sync.Pool
+	brotliPool sync.Pool
+	zstdPool   sync.Pool
+)
+
+// newEncoder function returns a pooled encoder of the encoding writing on w
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case "br":
+		if e, ok := brotliPool.Get().(*brotli.Writer); ok {
+			e.Reset(w)
+			return e
+		}
+		return brotli.NewWriterLevel(w, 4)
+	case "zstd":
+		if e, ok := zstdPool.Get().(*zstd.Encoder); ok {
+			e.Reset(w)
+			return e
+		}
+		e, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		return e
+	default:
+		if e, ok := gzipPool.Get().(*gzip.Writer); ok {
+			e.Reset(w)
+			return e
+		}
+		return gzip.NewWriter(w)
+	}
+}
+
+// releaseEncoder function returns the closed encoder to its pool
+func releaseEncoder(encoding string, e io.WriteCloser) {
+	switch encoding {
+	case "br":
+		brotliPool.Put(e)
+	case "zstd":
+		zstdPool.Put(e)
+	default:
+		gzipPool.Put(e)
+	}
+}
+
+// etagWriter struct buffers the successful response to compute its weak ETag
+type etagWriter struct {
+	gin.ResponseWriter
+	options     *CompressOptions
+	ifNoneMatch string
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+	hijacked    bool
+}
+
+// WriteHeader method
+func (w *etagWriter) WriteHeader(code int) {
+	if !w.passthrough && code > 0 {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// WriteHeaderNow method
+func (w *etagWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Status method
+func (w *etagWriter) Status() int {
+	if !w.passthrough && w.status != 0 {
+		return w.status
+	}
+
+	return w.ResponseWriter.Status()
+}
+
+// Written method
+func (w *etagWriter) Written() bool {
+	return w.passthrough && w.ResponseWriter.Written() || w.buf.Len() > 0
+}
+
+// Write method
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.buf.Len()+len(b) > w.options.ETagMaxSize {
+		if err := w.release(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	return w.buf.Write(b)
+}
+
+// WriteString method
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush method stops the buffering, a streamed response has no ETag
+func (w *etagWriter) Flush() {
+	_ = w.release()
+	w.ResponseWriter.Flush()
+}
+
+// Hijack method
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	w.passthrough = true
+	return w.ResponseWriter.Hijack()
+}
+
+// Unwrap method
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// release method writes the header and the buffered body, the rest of the response passes through
+func (w *etagWriter) release() error {
+	if w.passthrough {
+		return nil
+	}
+	w.passthrough = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+
+	return err
+}
+
+// finish method adds the ETag and answers 304 when it matches If-None-Match
+func (w *etagWriter) finish() {
+	if w.passthrough || w.hijacked {
+		return
+	}
+	h := w.Header()
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == http.StatusOK && w.buf.Len() > 0 && h.Get("ETag") == "" &&
+		mimeMatches(w.options.ETagMimeTypes, h.Get("Content-Type")) {
+		sum := fnv.New64a()
+		_, _ = sum.Write(w.buf.Bytes())
+		etag := "W/\"" + strconv.FormatInt(int64(w.buf.Len()), 16) + "-" + hex.EncodeToString(sum.Sum(nil)) + "\""
+		h.Set("ETag", etag)
+		if etagMatches(w.ifNoneMatch, etag) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.passthrough = true
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.ResponseWriter.WriteHeaderNow()
+			w.buf.Reset()
+			return
+		}
+	}
+	_ = w.release()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// etagMatches function compares the If-None-Match list with the ETag, weakly as RFC 9110 requires
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
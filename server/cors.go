@@ -16,6 +16,7 @@ package server
 import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,7 +30,7 @@ type CorsOptions struct {
 	AllowCredentials bool     `json:"allowCredentials" bson:"allowCredentials"`
 	ExposeHeaders    []string `json:"exposeHeaders" bson:"exposeHeaders"`
 	AllowWildcard    bool     `json:"allowWildcard" bson:"allowWildcard"`
-	MaxAgeSec        int      `json:"maxAgeSec" bson:"maxAgeSec"`
+	MaxAgeSec        int      `json:"maxAgeSec" bson:"maxAgeSec" validate:"min=0"`
 }
 
 // CorsConf struct
@@ -40,22 +41,36 @@ type CorsConf struct {
 // Cors variable
 var Cors CorsConf
 
+// corsHandler variable holds the handler built from the current cors options
+var corsHandler atomic.Value
+
 // CorsHandler function
 func CorsHandler() gin.HandlerFunc {
-	if !Cors.CorsOptions.UseSetting {
-		return func(c *gin.Context) {
-			return
-		}
+	corsHandler.Store(newCorsHandler(Cors.CorsOptions))
+	return currentCorsHandler
+}
+
+// currentCorsHandler function runs the handler of the current cors options
+func currentCorsHandler(c *gin.Context) {
+	if h, ok := corsHandler.Load().(gin.HandlerFunc); ok {
+		h(c)
+	}
+}
+
+// newCorsHandler function
+func newCorsHandler(options CorsOptions) gin.HandlerFunc {
+	if !options.UseSetting {
+		return func(c *gin.Context) {}
 	}
-	for _, v := range Cors.CorsOptions.AllowOrigins {
+	for _, v := range options.AllowOrigins {
 		if v == "*" {
 			return cors.New(cors.Config{
-				AllowMethods:     Cors.CorsOptions.AllowMethods,
-				AllowHeaders:     Cors.CorsOptions.AllowHeaders,
-				ExposeHeaders:    Cors.CorsOptions.ExposeHeaders,
-				AllowCredentials: Cors.CorsOptions.AllowCredentials,
-				MaxAge:           time.Duration(Cors.CorsOptions.MaxAgeSec) * time.Second,
-				AllowWildcard:    Cors.CorsOptions.AllowWildcard,
+				AllowMethods:     options.AllowMethods,
+				AllowHeaders:     options.AllowHeaders,
+				ExposeHeaders:    options.ExposeHeaders,
+				AllowCredentials: options.AllowCredentials,
+				MaxAge:           time.Duration(options.MaxAgeSec) * time.Second,
+				AllowWildcard:    options.AllowWildcard,
 				AllowOriginFunc: func(origin string) bool {
 					return true
 				},
@@ -63,12 +78,12 @@ func CorsHandler() gin.HandlerFunc {
 		}
 	}
 	return cors.New(cors.Config{
-		AllowOrigins:     Cors.CorsOptions.AllowOrigins,
-		AllowMethods:     Cors.CorsOptions.AllowMethods,
-		AllowHeaders:     Cors.CorsOptions.AllowHeaders,
-		ExposeHeaders:    Cors.CorsOptions.ExposeHeaders,
-		AllowCredentials: Cors.CorsOptions.AllowCredentials,
-		MaxAge:           time.Duration(Cors.CorsOptions.MaxAgeSec) * time.Second,
-		AllowWildcard:    Cors.CorsOptions.AllowWildcard,
+		AllowOrigins:     options.AllowOrigins,
+		AllowMethods:     options.AllowMethods,
+		AllowHeaders:     options.AllowHeaders,
+		ExposeHeaders:    options.ExposeHeaders,
+		AllowCredentials: options.AllowCredentials,
+		MaxAge:           time.Duration(options.MaxAgeSec) * time.Second,
+		AllowWildcard:    options.AllowWildcard,
 	})
 }
@@ -0,0 +1,641 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/jasacloud/go-libraries/broker"
+	"github.com/nats-io/nats.go"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// HubOverflowDrop constant drops the messages of a client whose buffer is full
+	HubOverflowDrop string = "drop"
+	// HubOverflowDisconnect constant disconnects a client whose buffer is full
+	HubOverflowDisconnect string = "disconnect"
+
+	// DefaultHubHeartbeatSec constant
+	DefaultHubHeartbeatSec int = 25
+	// DefaultHubBufferSize constant
+	DefaultHubBufferSize int = 64
+
+	// hubWriteWait is the time allowed to write a websocket frame
+	hubWriteWait = 10 * time.Second
+	// hubMaxRequest is the maximum size of a websocket request of a client
+	hubMaxRequest = 4096
+	// hubFeedRetry is the time between the attempts to consume again the queue of a closed feed
+	hubFeedRetry = 5 * time.Second
+)
+
+// ErrHubClosed variable
+var ErrHubClosed = errors.New("hub closed")
+
+// HubOptions is option of a Hub.
+// HeartbeatSec is the interval of the SSE comments and the websocket pings, 25 by default, a websocket client
+// missing two pongs is disconnected. BufferSize is the number of pending messages of a client, 64 by default,
+// when it is full the messages are dropped or the client is disconnected according to Overflow.
+// RequireAuth rejects the connections not authenticated by middlewares.Auth mounted before the handlers,
+// Authorize decides the topics a connection may subscribe to. AllowOrigins are the origins of the websocket
+// connections, "*" allows any origin, only the origin of the host is allowed by default.
+type HubOptions struct {
+	HeartbeatSec int                                     `json:"heartbeatSec" bson:"heartbeatSec" validate:"min=0"`
+	BufferSize   int                                     `json:"bufferSize" bson:"bufferSize" validate:"min=0"`
+	Overflow     string                                  `json:"overflow" bson:"overflow" validate:"omitempty,oneof=drop disconnect"`
+	RequireAuth  bool                                    `json:"requireAuth" bson:"requireAuth"`
+	AllowOrigins []string                                `json:"allowOrigins" bson:"allowOrigins"`
+	Authorize    func(c *gin.Context, topic string) bool `json:"-" bson:"-"`
+}
+
+// HubMessage struct is the message sent to the subscribers of its topic,
+// it is the data of an SSE event and a websocket text frame
+type HubMessage struct {
+	Topic string          `json:"topic"`
+	Event string          `json:"event,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// hubRequest struct is a request of a websocket client, the action is subscribe or unsubscribe
+type hubRequest struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+// Hub struct manages the subscriptions of the SSE and websocket clients by topic, e.g.
+//
+//	hub := server.NewHub(server.HubOptions{RequireAuth: true})
+//	server.Route.GET("/events", middlewares.Auth(opt), hub.SSEHandler())
+//	server.Route.GET("/ws", middlewares.Auth(opt), hub.WebSocketHandler())
+//	_ = hub.FeedNats("default", "orders.>", "")
+//
+// Browsers cannot set the Authorization header of an EventSource or a WebSocket,
+// they send the token in the access_token query parameter which middlewares.Auth reads too.
+type Hub struct {
+	options    HubOptions
+	upgrader   websocket.Upgrader
+	seq        atomic.Uint64
+	unregister func()
+
+	mu      sync.RWMutex
+	closed  bool
+	clients map[*hubClient]struct{}
+	topics  map[string]map[*hubClient]struct{}
+	feeds   []func()
+}
+
+// hubClient struct
+type hubClient struct {
+	send      chan HubMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+	topics    map[string]struct{}
+}
+
+// close method ends the connection of the client, the first reason is kept
+func (cl *hubClient) close(code int, text string) {
+	cl.closeOnce.Do(func() {
+		cl.closeCode, cl.closeText = code, text
+		close(cl.done)
+	})
+}
+
+// NewHub function returns a hub closed on shutdown before the servers are drained
+func NewHub(opt HubOptions) *Hub {
+	if opt.HeartbeatSec <= 0 {
+		opt.HeartbeatSec = DefaultHubHeartbeatSec
+	}
+	if opt.BufferSize <= 0 {
+		opt.BufferSize = DefaultHubBufferSize
+	}
+	if opt.Overflow == "" {
+		opt.Overflow = HubOverflowDrop
+	}
+	h := &Hub{
+		options: opt,
+		clients: make(map[*hubClient]struct{}),
+		topics:  make(map[string]map[*hubClient]struct{}),
+	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     h.checkOrigin,
+	}
+	h.unregister = onDrain(h.Close)
+
+	return h
+}
+
+// heartbeat method
+func (h *Hub) heartbeat() time.Duration {
+	return time.Duration(h.options.HeartbeatSec) * time.Second
+}
+
+// checkOrigin method
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, v := range h.options.AllowOrigins {
+		if v == "*" || strings.EqualFold(v, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Publish method sends data to the subscribers of the topic, data is encoded in JSON
+// unless it is a json.RawMessage or a []byte, which is sent as is when it is JSON and as a string otherwise
+func (h *Hub) Publish(topic string, data interface{}) error {
+	return h.PublishEvent(topic, "", data)
+}
+
+// PublishEvent method sends data to the subscribers of the topic as the event, the event is the event name of SSE
+func (h *Hub) PublishEvent(topic, event string, data interface{}) error {
+	var raw json.RawMessage
+	switch d := data.(type) {
+	case json.RawMessage:
+		raw = hubData(d)
+	case []byte:
+		raw = hubData(d)
+	default:
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		raw = b
+	}
+
+	return h.PublishMessage(HubMessage{Topic: topic, Event: event, Data: raw})
+}
+
+// PublishMessage method sends the message to the subscribers of its topic, the message is given
+// the next ID of the hub when it has none. A client whose buffer is full misses it or is disconnected.
+func (h *Hub) PublishMessage(m HubMessage) error {
+	if m.ID == "" {
+		m.ID = strconv.FormatUint(h.seq.Add(1), 10)
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return ErrHubClosed
+	}
+	for cl := range h.topics[m.Topic] {
+		h.deliver(cl, m)
+	}
+
+	return nil
+}
+
+// deliver method queues the message without blocking the publisher
+func (h *Hub) deliver(cl *hubClient, m HubMessage) {
+	select {
+	case <-cl.done:
+	case cl.send <- m:
+	default:
+		if h.options.Overflow == HubOverflowDisconnect {
+			cl.close(websocket.CloseTryAgainLater, "slow consumer")
+		}
+	}
+}
+
+// hubData function compacts the JSON data, other data is encoded as a JSON string
+func hubData(b []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if len(b) > 0 && json.Compact(&buf, b) == nil {
+		return buf.Bytes()
+	}
+	s, _ := json.Marshal(string(b))
+
+	return s
+}
+
+// Clients method returns the number of connected clients
+func (h *Hub) Clients() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.clients)
+}
+
+// Subscribers method returns the number of clients subscribed to the topic
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.topics[topic])
+}
+
+// Close method stops the feeds and disconnects the clients, it is called on shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	h.unregister()
+	feeds := h.feeds
+	h.feeds = nil
+	for cl := range h.clients {
+		cl.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	h.mu.Unlock()
+
+	for _, stop := range feeds {
+		stop()
+	}
+}
+
+// join method registers a client subscribed to the topics
+func (h *Hub) join(topics []string) (*hubClient, error) {
+	cl := &hubClient{
+		send:   make(chan HubMessage, h.options.BufferSize),
+		done:   make(chan struct{}),
+		topics: make(map[string]struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+	h.clients[cl] = struct{}{}
+	for _, t := range topics {
+		h.subscribeLocked(cl, t)
+	}
+
+	return cl, nil
+}
+
+// leave method unregisters the client and ends its connection
+func (h *Hub) leave(cl *hubClient) {
+	cl.close(websocket.CloseNormalClosure, "")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for t := range cl.topics {
+		h.unsubscribeLocked(cl, t)
+	}
+	delete(h.clients, cl)
+}
+
+// subscribe method
+func (h *Hub) subscribe(cl *hubClient, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[cl]; ok {
+		h.subscribeLocked(cl, topic)
+	}
+}
+
+// unsubscribe method
+func (h *Hub) unsubscribe(cl *hubClient, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribeLocked(cl, topic)
+}
+
+// subscribeLocked method
+func (h *Hub) subscribeLocked(cl *hubClient, topic string) {
+	subs := h.topics[topic]
+	if subs == nil {
+		subs = make(map[*hubClient]struct{})
+		h.topics[topic] = subs
+	}
+	subs[cl] = struct{}{}
+	cl.topics[topic] = struct{}{}
+}
+
+// unsubscribeLocked method
+func (h *Hub) unsubscribeLocked(cl *hubClient, topic string) {
+	delete(cl.topics, topic)
+	if subs := h.topics[topic]; subs != nil {
+		delete(subs, cl)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// authorized method reports whether the connection may subscribe to the topic
+func (h *Hub) authorized(c *gin.Context, topic string) bool {
+	if topic == "" {
+		return false
+	}
+
+	return h.options.Authorize == nil || h.options.Authorize(c, topic)
+}
+
+// admit method checks the authentication of the connection and the topics it subscribes to,
+// it responds the error envelope and returns false when the connection is refused
+func (h *Hub) admit(c *gin.Context, topics []string) bool {
+	h.mu.RLock()
+	closed := h.closed
+	h.mu.RUnlock()
+	if closed {
+		hubError(c, "503", "Service Unavailable", "server")
+		return false
+	}
+	if _, ok := c.Get("claims"); h.options.RequireAuth && !ok {
+		hubError(c, "401", "Request Unauthorized", "Authentication")
+		return false
+	}
+	for _, t := range topics {
+		if !h.authorized(c, t) {
+			hubError(c, "403", "Forbidden topic "+t, "Authorization")
+			return false
+		}
+	}
+
+	return true
+}
+
+// hubError function
+func hubError(c *gin.Context, code, message, typ string) {
+	body := ErrorResponse(code, message, c)
+	body["type"] = typ
+	c.AbortWithStatusJSON(200, gin.H{
+		"returnval": false,
+		"error":     body,
+	})
+}
+
+// SSEHandler method streams the messages of the topics of the topic query parameters as Server-Sent Events,
+// e.g. GET /events?topic=orders&topic=invoices. The data of an event is the JSON HubMessage,
+// the event name is its event when it has one and a comment is sent on every heartbeat.
+func (h *Hub) SSEHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		topics := c.QueryArray("topic")
+		if len(topics) == 0 {
+			hubError(c, "400", "Topic Required", "Request")
+			return
+		}
+		if !h.admit(c, topics) {
+			return
+		}
+		cl, err := h.join(topics)
+		if err != nil {
+			hubError(c, "503", "Service Unavailable", "server")
+			return
+		}
+		defer h.leave(cl)
+
+		// the stream outlives the write timeout of the server
+		rc := http.NewResponseController(c.Writer)
+		_ = rc.SetWriteDeadline(time.Time{})
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		ticker := time.NewTicker(h.heartbeat())
+		defer ticker.Stop()
+		var buf bytes.Buffer
+		for {
+			buf.Reset()
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-cl.done:
+				return
+			case m := <-cl.send:
+				b, _ := json.Marshal(m)
+				buf.WriteString("id: " + m.ID + "\n")
+				if m.Event != "" {
+					buf.WriteString("event: " + m.Event + "\n")
+				}
+				buf.WriteString("data: ")
+				buf.Write(b)
+				buf.WriteString("\n\n")
+			case <-ticker.C:
+				buf.WriteString(": ping\n\n")
+			}
+			if _, err := c.Writer.Write(buf.Bytes()); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// WebSocketHandler method upgrades the connection to a websocket subscribed to the topics of the topic
+// query parameters. The messages are sent as JSON HubMessage text frames, the client subscribes and
+// unsubscribes with {"action":"subscribe","topic":"orders"} and {"action":"unsubscribe","topic":"orders"},
+// a refused request is answered by a message of the event "error".
+func (h *Hub) WebSocketHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		topics := c.QueryArray("topic")
+		if !h.admit(c, topics) {
+			return
+		}
+		conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// the upgrader responds the error
+			Logf(c, "Websocket upgrade failed: %v", err)
+			c.Abort()
+			return
+		}
+		cl, err := h.join(topics)
+		if err != nil {
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(hubWriteWait))
+			_ = conn.Close()
+			return
+		}
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			h.writeSocket(conn, cl)
+		}()
+		h.readSocket(c, conn, cl)
+		h.leave(cl)
+		<-written
+	}
+}
+
+// readSocket method handles the requests of the client until its connection is closed
+// or misses the pongs of two heartbeats
+func (h *Hub) readSocket(c *gin.Context, conn *websocket.Conn, cl *hubClient) {
+	wait := 2 * h.heartbeat()
+	conn.SetReadLimit(hubMaxRequest)
+	_ = conn.SetReadDeadline(time.Now().Add(wait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wait))
+	})
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				Logf(c, "Websocket closed: %v", err)
+			}
+			return
+		}
+		var req hubRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			h.reply(cl, req.Topic, "Invalid Request")
+			continue
+		}
+		switch req.Action {
+		case "subscribe":
+			if !h.authorized(c, req.Topic) {
+				h.reply(cl, req.Topic, "Forbidden topic "+req.Topic)
+				continue
+			}
+			h.subscribe(cl, req.Topic)
+		case "unsubscribe":
+			h.unsubscribe(cl, req.Topic)
+		default:
+			h.reply(cl, req.Topic, "Unknown action "+req.Action)
+		}
+	}
+}
+
+// reply method sends an error message to the client
+func (h *Hub) reply(cl *hubClient, topic, message string) {
+	data, _ := json.Marshal(ErrorResponse("400", message))
+	h.deliver(cl, HubMessage{Topic: topic, Event: "error", Data: data})
+}
+
+// writeSocket method is the only writer of the connection, it sends the messages and the pings
+// and closes the connection when the client ends
+func (h *Hub) writeSocket(conn *websocket.Conn, cl *hubClient) {
+	ticker := time.NewTicker(h.heartbeat())
+	defer func() {
+		ticker.Stop()
+		_ = conn.Close()
+	}()
+	for {
+		select {
+		case m := <-cl.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(hubWriteWait))
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(hubWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-cl.done:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(cl.closeCode, cl.closeText), time.Now().Add(hubWriteWait))
+			return
+		}
+	}
+}
+
+// addFeed method registers the stop function of a feed, a feed added to a closed hub is stopped at once
+func (h *Hub) addFeed(stop func()) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		stop()
+		return ErrHubClosed
+	}
+	h.feeds = append(h.feeds, stop)
+	h.mu.Unlock()
+
+	return nil
+}
+
+// FeedNats method publishes the messages of the subject of the nats resource on the topic,
+// or on their subject when the topic is empty, e.g. for a wildcard subject
+func (h *Hub) FeedNats(resourceName, subject, topic string) error {
+	sub, err := broker.NatsSubscribe(resourceName, subject, func(msg *nats.Msg) {
+		t := topic
+		if t == "" {
+			t = msg.Subject
+		}
+		_ = h.PublishMessage(HubMessage{Topic: t, Data: hubData(msg.Data)})
+	})
+	if err != nil {
+		return err
+	}
+
+	return h.addFeed(func() {
+		_ = sub.Unsubscribe()
+	})
+}
+
+// FeedAmqp method publishes the deliveries of the queue of the amqp resource on the topic,
+// or on their routing key when the topic is empty. The type of a delivery is the event of its message.
+// The deliveries are acknowledged on receipt: like the messages of the hub, they are delivered at most once
+// and lost when no client is subscribed. When the channel is closed the feed consumes the queue again
+// every hubFeedRetry until the hub is closed.
+func (h *Hub) FeedAmqp(resourceName, queue, topic string) error {
+	ch, deliveries, err := broker.AmqpConsume(resourceName, queue)
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			for d := range deliveries {
+				broker.CountConsumed("amqp", queue)
+				t := topic
+				if t == "" {
+					t = d.RoutingKey
+				}
+				_ = h.PublishMessage(HubMessage{Topic: t, Event: d.Type, Data: hubData(d.Body)})
+			}
+			for deliveries = nil; deliveries == nil; {
+				select {
+				case <-stopped:
+					log.Printf("The hub feed of the amqp queue %s is stopped", queue)
+					return
+				case <-time.After(hubFeedRetry):
+				}
+				c, ds, err := broker.AmqpConsume(resourceName, queue)
+				if err != nil {
+					log.Printf("Failed consume the amqp queue %s of the hub feed: %v", queue, err)
+					continue
+				}
+				mu.Lock()
+				select {
+				case <-stopped:
+					_ = c.Close()
+				default:
+					ch, deliveries = c, ds
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	return h.addFeed(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		close(stopped)
+		_ = ch.Close()
+	})
+}
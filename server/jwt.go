@@ -13,7 +13,13 @@
 
 package server
 
-import "github.com/jasacloud/go-libraries/config"
+import (
+	"errors"
+	"github.com/jasacloud/go-libraries/config"
+	"io/ioutil"
+	"log"
+	"sync"
+)
 
 // JwtConf struct
 type JwtConf struct {
@@ -22,25 +28,71 @@ type JwtConf struct {
 
 // JwtOption struct
 type JwtOption struct {
-	Name          string `json:"name" bson:"name"`
-	Secret        string `json:"secret" bson:"secret"`
-	Algorithm     string `json:"algorithm" bson:"algorithm"`
+	Name          string `json:"name" bson:"name" validate:"required"`
+	Secret        string `json:"secret" bson:"secret" secret:"true"`
+	Algorithm     string `json:"algorithm" bson:"algorithm" validate:"required"`
 	ExpirationSec int    `json:"expiration" bson:"expiration"`
 	PrivateKey    string `json:"privateKey" bson:"privateKey"`
 	PublicKey     string `json:"publicKey" bson:"publicKey"`
 }
 
+func init() {
+	config.RegisterResources("jwtResources", JwtOption{})
+	config.Subscribe(reloadJwt)
+}
+
 var (
-	// Secret variable
+	// Secret variable is not updated anymore, use GetJwtOption which reads the current config
 	Secret JwtConf
 )
 
-// PrivateKey variable
+// PrivateKey variable caches the private key files by path, read it with JwtPrivateKey
 var PrivateKey = make(map[string]interface{})
 
-// PublicKey variable
+// PublicKey variable caches the public key files by path, read it with JwtPublicKey
 var PublicKey = make(map[string]interface{})
 
+// keysMu guards PrivateKey and PublicKey
+var keysMu sync.Mutex
+
+// JwtPrivateKey function returns the content of the private key file, read once until the config is reloaded
+func JwtPrivateKey(path string) []byte {
+	return readKey(PrivateKey, path)
+}
+
+// JwtPublicKey function returns the content of the public key file, read once until the config is reloaded
+func JwtPublicKey(path string) []byte {
+	return readKey(PublicKey, path)
+}
+
+// readKey function
+func readKey(keys map[string]interface{}, path string) []byte {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if b, ok := keys[path].([]byte); ok {
+		return b
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	keys[path] = b
+
+	return b
+}
+
+// reloadJwt function drops the cached key files, a reloaded config may rotate them
+func reloadJwt(_, _ *config.Config) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	for k := range PrivateKey {
+		delete(PrivateKey, k)
+	}
+	for k := range PublicKey {
+		delete(PublicKey, k)
+	}
+}
+
 // DefaultResourceName variable
 var DefaultResourceName = ""
 
@@ -49,13 +101,10 @@ func GetJwtOption(resourceName string) JwtOption {
 	if DefaultResourceName == "" {
 		DefaultResourceName = resourceName
 	}
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Secret)
-	for _, v := range Secret.JwtOptions {
-		if v.Name == resourceName {
-			return v
-		}
+	r, err := config.Resource[JwtOption]("jwtResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load jwt resource "+resourceName+", error: ", err)
 	}
 
-	return JwtOption{}
+	return r
 }
@@ -1,18 +1,33 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/health"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// startupCheckInterval is the interval of the health checks until the startup succeeds
+const startupCheckInterval = time.Second
+
 type svcLifecycle struct {
 	isReady             *atomic.Value
+	isStopped           atomic.Bool
 	readyzProbeDuration time.Duration
+	details             bool
 }
 
+var (
+	lifecyclesMu sync.Mutex
+	lifecycles   []*svcLifecycle
+)
+
 func NewSvcLifecycle() *svcLifecycle {
 	lc := &svcLifecycle{
 		isReady: &atomic.Value{},
@@ -27,40 +42,144 @@ func (slc *svcLifecycle) SetDuration(d time.Duration) *svcLifecycle {
 	return slc
 }
 
-// Init is run lifecycle runtime
+// SetDetails is set the probes to respond the components of the report with their errors,
+// only the status is responded by default. Enable it on probes served to operators only, e.g. an admin listener.
+func (slc *svcLifecycle) SetDetails(details bool) *svcLifecycle {
+	slc.details = details
+	return slc
+}
+
+// RegisterCheck registers a readiness check, see health.Register. The resource packages register
+// the checks of the resources they connect.
+func (slc *svcLifecycle) RegisterCheck(name string, check health.CheckFunc, opts ...health.Options) *svcLifecycle {
+	health.Register(name, check, opts...)
+	return slc
+}
+
+// Init is run lifecycle runtime, the startup succeeds once the probe duration elapsed
+// and every required health check passed
 func (slc *svcLifecycle) Init() *svcLifecycle {
 	slc.isReady.Store(false)
+	lifecyclesMu.Lock()
+	lifecycles = append(lifecycles, slc)
+	lifecyclesMu.Unlock()
 	go func() {
 		log.Printf("Readyz probe is negative by default...")
 		time.Sleep(slc.readyzProbeDuration)
-		slc.isReady.Store(true)
-		log.Printf("Readyz probe is positive.")
+		logged := false
+		for !slc.isStopped.Load() {
+			report := health.Check(context.Background())
+			if report.Ready() {
+				slc.isReady.Store(true)
+				log.Printf("Readyz probe is positive.")
+				return
+			}
+			if !logged {
+				log.Printf("Readyz probe is waiting for: %s", strings.Join(downComponents(report), ", "))
+				logged = true
+			}
+			time.Sleep(startupCheckInterval)
+		}
 	}()
 	return slc
 }
 
+// Stop is turn the ready probe negative for good, the server is shutting down
+func (slc *svcLifecycle) Stop() {
+	slc.isStopped.Store(true)
+	slc.isReady.Store(false)
+	log.Printf("Readyz probe is negative, shutting down.")
+}
+
+// stopLifecycles function stops every initialized lifecycle
+func stopLifecycles() {
+	lifecyclesMu.Lock()
+	defer lifecyclesMu.Unlock()
+	for _, slc := range lifecycles {
+		slc.Stop()
+	}
+}
+
 // Healthz is a liveness probe.
 func (slc *svcLifecycle) Healthz(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// Readyz is a readiness probe.
+// readinessReport struct
+type readinessReport struct {
+	health.Report
+	Started bool `json:"started"`
+}
+
+// started method
+func (slc *svcLifecycle) started() bool {
+	return slc.isReady != nil && slc.isReady.Load() == true && !slc.isStopped.Load()
+}
+
+// Readyz is a readiness probe, it responds the JSON status of the health checks, see SetDetails.
+// The probe is negative until the startup succeeded and once the server is shutting down.
 func (slc *svcLifecycle) Readyz() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if slc.isReady == nil || !slc.isReady.Load().(bool) {
-			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
-			return
+		report := readinessReport{
+			Report:  health.Check(r.Context()),
+			Started: slc.started(),
+		}
+		if !report.Started {
+			report.Status = health.StatusDown
+		}
+		slc.writeReport(w, report)
+	}
+}
+
+// Startupz is a startup probe, positive once the startup succeeded
+func (slc *svcLifecycle) Startupz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readinessReport{
+			Report:  health.Report{Status: health.StatusUp},
+			Started: slc.started(),
+		}
+		if !report.Started {
+			report.Report = health.Check(r.Context())
+			report.Status = health.StatusDown
 		}
+		slc.writeReport(w, report)
+	}
+}
+
+// writeReport method, the components are left out unless details are enabled
+func (slc *svcLifecycle) writeReport(w http.ResponseWriter, report readinessReport) {
+	if !slc.details {
+		report.Components = nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == health.StatusUp {
 		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// downComponents function
+func downComponents(report health.Report) []string {
+	var names []string
+	for _, c := range report.Components {
+		if c.Status != health.StatusUp && !c.Optional {
+			names = append(names, c.Name+" ("+c.Error+")")
+		}
+	}
+
+	return names
 }
 
-// LoadDefaultLifecycle is enable lifecycle liveness and readiness probe
+// LoadDefaultLifecycle is enable lifecycle liveness, readiness and startup probe
 func LoadDefaultLifecycle() {
 	if Route != nil {
 		lifecycle := NewSvcLifecycle().SetDuration(5 * time.Second).Init()
 		Route.GET("/healthz", gin.WrapF(lifecycle.Healthz))
 		Route.GET("/readyz", gin.WrapH(lifecycle.Readyz()))
+		Route.GET("/startupz", gin.WrapH(lifecycle.Startupz()))
 		return
 	}
 	log.Fatal("server route not loaded, please init load server first")
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/config"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// DefaultEngine constant is the engine name of the global Route
+const DefaultEngine string = "default"
+
+// ListenResource struct is a named listener, network is "tcp" (default) or "unix".
+// Listeners having the same engine name serve the same gin engine, the engine defaults to the listener name.
+type ListenResource struct {
+	Name       string `json:"name" bson:"name" validate:"required"`
+	Network    string `json:"network" bson:"network" validate:"omitempty,oneof=tcp unix"`
+	ListenAddr string `json:"listenAddr" bson:"listenAddr"`
+	ListenPort string `json:"listenPort" bson:"listenPort" validate:"required_unless=Network unix,omitempty,numeric"`
+	Socket     string `json:"socket" bson:"socket" validate:"required_if=Network unix"`
+	Engine     string `json:"engine" bson:"engine"`
+	Ssl        bool   `json:"ssl" bson:"ssl"`
+	CertFile   string `json:"certFile" bson:"certFile" validate:"required_if=Ssl true"`
+	KeyFile    string `json:"keyFile" bson:"keyFile" validate:"required_if=Ssl true"`
+	// ClientCaFile, ClientAuth and CertReloadSec are the same as in ListenSsl
+	ClientCaFile  string `json:"clientCaFile" bson:"clientCaFile"`
+	ClientAuth    string `json:"clientAuth" bson:"clientAuth" validate:"omitempty,oneof=none request requireAny verifyIfGiven require"`
+	CertReloadSec int    `json:"certReloadSec" bson:"certReloadSec" validate:"min=0"`
+	// Options override the server options of the listen section
+	Options *ServerOptions `json:"options" bson:"options"`
+}
+
+// ListenResources struct
+type ListenResources struct {
+	ListenResources []ListenResource `json:"listenResources" bson:"listenResources"`
+}
+
+func init() {
+	config.RegisterResources("listenResources", ListenResource{})
+}
+
+var (
+	// ListenResourcesConfig variable
+	ListenResourcesConfig ListenResources
+
+	enginesMu sync.Mutex
+	engines   = make(map[string]*gin.Engine)
+)
+
+// addr method
+func (l ListenResource) addr() string {
+	if l.Network == "unix" {
+		return l.Socket
+	}
+
+	return Listen{ListenAddr: l.ListenAddr, ListenPort: l.ListenPort}.addr()
+}
+
+// engine method
+func (l ListenResource) engine() string {
+	if l.Engine == "" {
+		return l.Name
+	}
+
+	return l.Engine
+}
+
+// GetListenResource function
+func GetListenResource(resourceName string) ListenResource {
+	for _, v := range ListenResourcesConfig.ListenResources {
+		if v.Name == resourceName {
+			return v
+		}
+	}
+
+	return ListenResource{}
+}
+
+// Engine function returns the gin engine of the name, creating it on first use. The "default" engine is Route.
+// Register the routes of a listener on the engine of its name, e.g. Engine("admin").GET("/metrics", ...).
+func Engine(name string) *gin.Engine {
+	if name == DefaultEngine {
+		return Route
+	}
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	if engines[name] == nil {
+		engines[name] = newEngine(Mode)
+		engines[name].Use(TraceHandler, currentAccessLogHandler, metricsHandler, latencyHandler, RecoveryHandler, clientCertHandler, currentCorsHandler, currentCompressHandler)
+	}
+
+	return engines[name]
+}
+
+// Group function returns a route group of the listener engine, e.g. Group("admin", "/debug")
+func Group(name, relativePath string, handlers ...gin.HandlerFunc) *gin.RouterGroup {
+	return Engine(GetListenResource(name).engine()).Group(relativePath, handlers...)
+}
+
+// startListeners function starts every listener of listenResources in background
+func startListeners() {
+	for _, l := range ListenResourcesConfig.ListenResources {
+		go runListener(l, Engine(l.engine()))
+	}
+}
+
+// runListener function
+func runListener(l ListenResource, engine http.Handler) {
+	network := l.Network
+	if network == "" {
+		network = "tcp"
+	}
+	debugPrint("Listening and serving %s on %s %s (%s)\n", scheme(l.Ssl), network, l.addr(), l.Name)
+
+	srv := &http.Server{Addr: l.addr(), Handler: engine}
+	options := ListenConfig.Listen.Options
+	if l.Options != nil {
+		options = *l.Options
+	}
+	options.apply(srv)
+	if l.Ssl {
+		ssl := ListenSsl{
+			CertFile:      l.CertFile,
+			KeyFile:       l.KeyFile,
+			ClientCaFile:  l.ClientCaFile,
+			ClientAuth:    l.ClientAuth,
+			CertReloadSec: l.CertReloadSec,
+		}
+		ssl.resolvePaths()
+		tlsConfig, err := ssl.tlsConfig()
+		if err != nil {
+			log.Fatalf("Server listen failed: listener %s: %v", l.Name, err)
+		}
+		srv.TLSConfig = tlsConfig
+	}
+	serve(srv, func() error {
+		if network == "unix" {
+			// remove the socket left by a previous process
+			if err := os.Remove(l.Socket); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("listener %s: %w", l.Name, err)
+			}
+		}
+		ln, err := net.Listen(network, l.addr())
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", l.Name, err)
+		}
+		if l.Ssl {
+			return srv.ServeTLS(ln, "", "")
+		}
+		return srv.Serve(ln)
+	})
+}
+
+// scheme function
+func scheme(ssl bool) string {
+	if ssl {
+		return "HTTPS"
+	}
+
+	return "HTTP"
+}
+
+// hasListen function reports whether the listen section declares the plain or TLS listener
+func hasListen() bool {
+	return ListenConfig.Listen.ListenPort != "" || ListenConfig.Listen.Ssl
+}
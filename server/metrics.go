@@ -0,0 +1,51 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/metrics"
+	"log"
+	"time"
+)
+
+// metricsHandler function records the handled requests by route template, unknown routes are "unmatched"
+func metricsHandler(c *gin.Context) {
+	start := time.Now()
+	metrics.HttpRequestsInFlight.Inc()
+	defer metrics.HttpRequestsInFlight.Dec()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	metrics.HttpRequestDuration.
+		WithLabelValues(c.Request.Method, route, metrics.StatusCode(c.Writer.Status())).
+		Observe(time.Since(start).Seconds())
+}
+
+// MetricsHandler function serves the metrics, e.g. Engine("admin").GET("/metrics", MetricsHandler())
+func MetricsHandler() gin.HandlerFunc {
+	return gin.WrapH(metrics.Handler())
+}
+
+// LoadDefaultMetrics is enable the prometheus metrics endpoint on /metrics
+func LoadDefaultMetrics() {
+	if Route != nil {
+		Route.GET("/metrics", MetricsHandler())
+		return
+	}
+	log.Fatal("server route not loaded, please init load server first")
+}
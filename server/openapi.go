@@ -0,0 +1,105 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/openapi"
+	"log"
+	"strings"
+)
+
+const (
+	// DefaultOpenApiPath constant
+	DefaultOpenApiPath string = "/openapi.json"
+	// DefaultOpenApiUiPath constant
+	DefaultOpenApiUiPath string = "/docs"
+)
+
+// OpenApiOptions is option of the OpenAPI document that defined from config.
+// Path is the path of the document, /openapi.json by default, UiPath is the path of the Swagger UI page,
+// /docs by default or "-" to disable it. Document the routes with openapi.Doc.
+type OpenApiOptions struct {
+	Enable      bool             `json:"enable" bson:"enable"`
+	Path        string           `json:"path" bson:"path" validate:"omitempty,startswith=/"`
+	UiPath      string           `json:"uiPath" bson:"uiPath" validate:"omitempty,startswith=/|eq=-"`
+	Title       string           `json:"title" bson:"title"`
+	Description string           `json:"description" bson:"description"`
+	Version     string           `json:"version" bson:"version"`
+	Servers     []openapi.Server `json:"servers" bson:"servers"`
+}
+
+// OpenApiConf struct
+type OpenApiConf struct {
+	OpenApi OpenApiOptions `json:"openapi" bson:"openapi"`
+}
+
+// OpenApi variable
+var OpenApi OpenApiConf
+
+// info method
+func (o OpenApiOptions) info() openapi.Info {
+	info := openapi.Info{
+		Title:       o.Title,
+		Description: o.Description,
+		Version:     o.Version,
+	}
+	if info.Title == "" {
+		info.Title = "API"
+	}
+	if info.Version == "" {
+		info.Version = "1.0.0"
+	}
+
+	return info
+}
+
+// OpenApiHandler function serves the OpenAPI document of the routes of the engine,
+// e.g. Engine("admin").GET("/openapi.json", OpenApiHandler(Engine("admin"), OpenApi.OpenApi))
+func OpenApiHandler(engine *gin.Engine, opt OpenApiOptions) gin.HandlerFunc {
+	return openapi.Handler(engine, opt.info(), opt.Servers...)
+}
+
+// loadOpenApi function serves the document and the Swagger UI of the engine on it
+func loadOpenApi(engine *gin.Engine, opt OpenApiOptions) {
+	if opt.Path == "" {
+		opt.Path = DefaultOpenApiPath
+	}
+	if opt.UiPath == "" {
+		opt.UiPath = DefaultOpenApiUiPath
+	}
+	openapi.Hide("GET", opt.Path)
+	engine.GET(opt.Path, OpenApiHandler(engine, opt))
+	if opt.UiPath != "-" {
+		openapi.Hide("GET", opt.UiPath)
+		engine.GET(opt.UiPath, openapi.UiHandler(opt.info().Title, opt.Path))
+		if openapi.SwaggerUiURL == "" {
+			assets := strings.TrimSuffix(opt.UiPath, "/") + "/assets/*file"
+			openapi.Hide("GET", assets)
+			engine.GET(assets, openapi.AssetsHandler())
+		}
+	}
+}
+
+// LoadDefaultOpenApi is enable the OpenAPI document and the Swagger UI of Route with the openapi section,
+// when the section does not enable them already
+func LoadDefaultOpenApi() {
+	if Route != nil {
+		if !OpenApi.OpenApi.Enable {
+			loadOpenApi(Route, OpenApi.OpenApi)
+		}
+		return
+	}
+	log.Fatal("server route not loaded, please init load server first")
+}
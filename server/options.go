@@ -0,0 +1,91 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// Default server options, the header timeout protects against slowloris clients. Read and write
+// timeouts have no default, they would cut long downloads, uploads and streams.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+)
+
+// ServerOptions struct tunes the http servers, a zero header or idle timeout uses the default and -1 disables it.
+// Read and write timeouts are disabled unless configured.
+// Protocols are "http1", "http2" (over TLS) and "h2c" (HTTP/2 cleartext with prior knowledge),
+// http1 and http2 by default. HTTP/3 is served by a QUIC proxy in front, AltSvc advertises it.
+type ServerOptions struct {
+	ReadHeaderTimeoutSec int      `json:"readHeaderTimeoutSec" bson:"readHeaderTimeoutSec" validate:"min=-1"`
+	ReadTimeoutSec       int      `json:"readTimeoutSec" bson:"readTimeoutSec" validate:"min=-1"`
+	WriteTimeoutSec      int      `json:"writeTimeoutSec" bson:"writeTimeoutSec" validate:"min=-1"`
+	IdleTimeoutSec       int      `json:"idleTimeoutSec" bson:"idleTimeoutSec" validate:"min=-1"`
+	MaxHeaderBytes       int      `json:"maxHeaderBytes" bson:"maxHeaderBytes" validate:"min=0"`
+	Protocols            []string `json:"protocols" bson:"protocols" validate:"dive,oneof=http1 http2 h2c"`
+	AltSvc               string   `json:"altSvc" bson:"altSvc"`
+}
+
+// timeout function
+func timeout(sec int, def time.Duration) time.Duration {
+	switch {
+	case sec < 0:
+		return 0
+	case sec == 0:
+		return def
+	default:
+		return time.Duration(sec) * time.Second
+	}
+}
+
+// protocols method
+func (o ServerOptions) protocols() *http.Protocols {
+	p := &http.Protocols{}
+	if len(o.Protocols) == 0 {
+		p.SetHTTP1(true)
+		p.SetHTTP2(true)
+		return p
+	}
+	for _, v := range o.Protocols {
+		switch v {
+		case "http1":
+			p.SetHTTP1(true)
+		case "http2":
+			p.SetHTTP2(true)
+		case "h2c":
+			p.SetUnencryptedHTTP2(true)
+		}
+	}
+
+	return p
+}
+
+// apply method sets the options on the server, call it after the handler is set
+func (o ServerOptions) apply(s *http.Server) {
+	s.ReadHeaderTimeout = timeout(o.ReadHeaderTimeoutSec, DefaultReadHeaderTimeout)
+	s.ReadTimeout = timeout(o.ReadTimeoutSec, 0)
+	s.WriteTimeout = timeout(o.WriteTimeoutSec, 0)
+	s.IdleTimeout = timeout(o.IdleTimeoutSec, DefaultIdleTimeout)
+	s.MaxHeaderBytes = o.MaxHeaderBytes
+	s.Protocols = o.protocols()
+	if o.AltSvc != "" && s.Handler != nil {
+		h := s.Handler
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Alt-Svc", o.AltSvc)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
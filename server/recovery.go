@@ -0,0 +1,102 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"syscall"
+)
+
+// PanicHook type receives the recovered value and the stack trace of a panicking request,
+// e.g. to report it to an error tracker
+type PanicHook func(c *gin.Context, recovered interface{}, stack []byte)
+
+var (
+	panicHooksMu sync.RWMutex
+	panicHooks   []PanicHook
+)
+
+// OnPanic function registers a hook run when a handler panics
+func OnPanic(hook PanicHook) {
+	panicHooksMu.Lock()
+	defer panicHooksMu.Unlock()
+	panicHooks = append(panicHooks, hook)
+}
+
+// RecoveryHandler function recovers the panics of the handlers, logs the stack trace with the request ID
+// and responds the error envelope with code 500, with the http status 200 as ErrorHandler does.
+// The panic value is only exposed in message_details in debug mode.
+func RecoveryHandler(c *gin.Context) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if r == http.ErrAbortHandler {
+			// the handler aborts the response on purpose, let net/http close the connection
+			panic(r)
+		}
+		if err, ok := r.(error); ok && brokenConnection(err) {
+			Logf(c, "Connection lost: %v", err)
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+
+		stack := debug.Stack()
+		Logf(c, "Panic recovered: %v\n%s", r, stack)
+		runPanicHooks(c, r, stack)
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		body := ErrorResponse("500", "Internal Server Error", c)
+		body["type"] = "server"
+		if debugging() {
+			body["message_details"] = fmt.Sprint(r)
+		}
+		c.AbortWithStatusJSON(200, gin.H{
+			"returnval": false,
+			"error":     body,
+		})
+	}()
+	c.Next()
+}
+
+// runPanicHooks function, a panicking hook does not prevent the response
+func runPanicHooks(c *gin.Context, r interface{}, stack []byte) {
+	panicHooksMu.RLock()
+	hooks := append([]PanicHook(nil), panicHooks...)
+	panicHooksMu.RUnlock()
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if e := recover(); e != nil {
+					Logf(c, "Panic hook failed: %v", e)
+				}
+			}()
+			hook(c, r, stack)
+		}()
+	}
+}
+
+// brokenConnection function reports whether the client is gone, the response cannot be written
+func brokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
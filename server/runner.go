@@ -5,18 +5,30 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/config"
 	"golang.org/x/crypto/acme/autocert"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-var (
-	srv    *http.Server
-	srvTLS *http.Server
+// DefaultShutdownTimeout constant is the time given to in-flight requests to finish on shutdown
+const DefaultShutdownTimeout = 30 * time.Second
 
-	onShutdownFunc func()
+var (
+	serversMu sync.Mutex
+	servers   []*http.Server
+	stopping  bool
+
+	onDrainFuncs []*func()
+	onStopFuncs  []func()
+	stopOnce     sync.Once
+	stopped      = make(chan struct{})
 )
 
 // runAutoCert support 1-line LetsEncrypt HTTPS servers
@@ -26,20 +38,23 @@ func runAutoCert(r http.Handler, domain ...string) error {
 
 // runWithManager support custom autocert manager
 func runWithManager(r http.Handler, m *autocert.Manager) {
-	srvTLS = &http.Server{
+	srv := &http.Server{
+		Addr:    ":http",
+		Handler: m.HTTPHandler(http.HandlerFunc(redirect)),
+	}
+	srvTLS := &http.Server{
 		Addr:      ":https",
 		TLSConfig: m.TLSConfig(),
 		Handler:   r,
 	}
 
-	go func() {
-		if err := http.ListenAndServe(":http", m.HTTPHandler(http.HandlerFunc(redirect))); !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Server listen failed: %v", err)
-		}
-	}()
-	if err := srvTLS.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("Server listen failed: %v", err)
-	}
+	ListenConfig.Listen.Options.apply(srv)
+	ListenConfig.Listen.Options.apply(srvTLS)
+
+	go serve(srv, srv.ListenAndServe)
+	serve(srvTLS, func() error {
+		return srvTLS.ListenAndServeTLS("", "")
+	})
 }
 
 // redirect function
@@ -54,16 +69,19 @@ func redirect(w http.ResponseWriter, req *http.Request) {
 }
 
 // runTLS function
-func runTLS(addr string, engine http.Handler, certFile, keyFile string) {
+func runTLS(engine http.Handler, ssl ListenSsl) {
+	addr := ssl.addr()
 	debugPrint("Listening and serving HTTPS on %s\n", addr)
 
-	srvTLS = &http.Server{Addr: addr, Handler: engine}
-	if onShutdownFunc != nil {
-		srv.RegisterOnShutdown(onShutdownFunc)
-	}
-	if err := srvTLS.ListenAndServeTLS(certFile, keyFile); !errors.Is(err, http.ErrServerClosed) {
+	tlsConfig, err := ssl.tlsConfig()
+	if err != nil {
 		log.Fatalf("Server listen failed: %v", err)
 	}
+	srvTLS := &http.Server{Addr: addr, Handler: engine, TLSConfig: tlsConfig}
+	ListenConfig.Listen.Options.apply(srvTLS)
+	serve(srvTLS, func() error {
+		return srvTLS.ListenAndServeTLS("", "")
+	})
 }
 
 // run function
@@ -71,39 +89,132 @@ func run(engine http.Handler, addr ...string) {
 	address := resolveAddress(addr)
 	debugPrint("Listening and serving HTTP on %s\n", address)
 
-	srv = &http.Server{Addr: address, Handler: engine}
-	if onShutdownFunc != nil {
-		srv.RegisterOnShutdown(onShutdownFunc)
+	srv := &http.Server{Addr: address, Handler: engine}
+	ListenConfig.Listen.Options.apply(srv)
+	serve(srv, srv.ListenAndServe)
+}
+
+// serve function tracks the server for shutdown and runs listen until the server is closed
+func serve(s *http.Server, listen func() error) {
+	serversMu.Lock()
+	if stopping {
+		serversMu.Unlock()
+		return
 	}
-	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+	servers = append(servers, s)
+	serversMu.Unlock()
+
+	if err := listen(); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server listen failed: %v", err)
 	}
 }
 
+// onShutdown function registers a hook run after the servers are drained
 func onShutdown(f func()) {
-	onShutdownFunc = f
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	onStopFuncs = append(onStopFuncs, f)
 }
 
-func shutdown() {
-	if srv != nil {
-		if err := srv.Shutdown(context.TODO()); err != nil {
-			log.Printf("The service is shutting down with error: %v", err)
-		} else {
-			log.Print("The service is shutting down...")
+// onDrain function registers a hook run before the servers are drained,
+// e.g. to end the long-lived streams which would hold the drain until its timeout.
+// The returned function unregisters the hook.
+func onDrain(f func()) func() {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	hook := &f
+	onDrainFuncs = append(onDrainFuncs, hook)
+
+	return func() {
+		serversMu.Lock()
+		defer serversMu.Unlock()
+		// a new slice, the shutdown may be running the hooks of the current one
+		hooks := make([]*func(), 0, len(onDrainFuncs))
+		for _, h := range onDrainFuncs {
+			if h != hook {
+				hooks = append(hooks, h)
+			}
 		}
+		onDrainFuncs = hooks
 	}
-	if srvTLS != nil {
-		if err := srvTLS.Shutdown(context.TODO()); err != nil {
-			log.Printf("The service is shutting down with error: %v", err)
-		} else {
-			log.Print("The service is shutting down...")
-		}
+}
+
+// handleSignals function shuts down on SIGINT or SIGTERM, a second signal terminates the process
+func handleSignals() {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	select {
+	case sig := <-quit:
+		signal.Stop(quit)
+		log.Printf("Received %s signal", sig)
+		shutdown()
+	case <-stopped:
+		signal.Stop(quit)
 	}
 }
 
+// shutdownTimeout function
+func shutdownTimeout() time.Duration {
+	if ListenConfig.Listen.ShutdownTimeoutSec > 0 {
+		return time.Duration(ListenConfig.Listen.ShutdownTimeoutSec) * time.Second
+	}
+
+	return DefaultShutdownTimeout
+}
+
+// shutdown function flips the readiness probes to negative, ends the streams of the hubs,
+// stops accepting connections, drains in-flight requests within the shutdown timeout, then runs the OnStop hooks
+// in reverse order and closes the config resources. It runs once, later calls wait for it.
+func shutdown() {
+	stopOnce.Do(func() {
+		defer close(stopped)
+		log.Print("The service is shutting down...")
+		stopLifecycles()
+		if d := ListenConfig.Listen.ShutdownDelaySec; d > 0 {
+			// give load balancers the time to see the negative readiness probe
+			time.Sleep(time.Duration(d) * time.Second)
+		}
+
+		serversMu.Lock()
+		stopping = true
+		ss := servers
+		drains := onDrainFuncs
+		hooks := onStopFuncs
+		serversMu.Unlock()
+
+		for _, f := range drains {
+			(*f)()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, s := range ss {
+			wg.Add(1)
+			go func(s *http.Server) {
+				defer wg.Done()
+				if err := s.Shutdown(ctx); err != nil {
+					log.Printf("The server %s is shutting down with error: %v", s.Addr, err)
+					_ = s.Close()
+				}
+			}(s)
+		}
+		wg.Wait()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hooks[i]()
+		}
+		if err := config.CloseResources(); err != nil {
+			log.Printf("Failed close resources: %v", err)
+		}
+		log.Print("The service is stopped")
+	})
+	<-stopped
+}
+
 // debugPrint function
 func debugPrint(format string, values ...interface{}) {
-	if gin.IsDebugging() {
+	if debugging() {
 		if !strings.HasSuffix(format, "\n") {
 			format += "\n"
 		}
@@ -114,7 +225,7 @@ func debugPrint(format string, values ...interface{}) {
 // debugPrintError function
 func debugPrintError(err error) {
 	if err != nil {
-		if gin.IsDebugging() {
+		if debugging() {
 			fmt.Fprintf(gin.DefaultErrorWriter, "[GIN-debug] [ERROR] %v\n", err)
 		}
 	}
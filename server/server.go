@@ -23,6 +23,7 @@ import (
 	"github.com/jasacloud/go-libraries/config"
 	"github.com/jasacloud/go-libraries/helper"
 	"github.com/jasacloud/go-libraries/system"
+	"github.com/jasacloud/go-libraries/utils/content"
 	"golang.org/x/crypto/acme/autocert"
 	"io"
 	"io/ioutil"
@@ -30,14 +31,22 @@ import (
 	"path"
 	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Listen struct
 type Listen struct {
 	ListenAddr string `json:"listenAddr" bson:"listenAddr"`
-	ListenPort string `json:"listenPort" bson:"listenPort"`
+	ListenPort string `json:"listenPort" bson:"listenPort" validate:"omitempty,numeric"`
 	Ssl        bool   `json:"ssl" bson:"ssl"`
+	// ShutdownTimeoutSec is the time given to in-flight requests on shutdown, 30 seconds by default
+	ShutdownTimeoutSec int `json:"shutdownTimeoutSec" bson:"shutdownTimeoutSec" validate:"min=0"`
+	// ShutdownDelaySec is the time between the negative readiness probe and closing the listeners
+	ShutdownDelaySec int `json:"shutdownDelaySec" bson:"shutdownDelaySec" validate:"min=0"`
+	// Options are the timeouts and protocols of every server
+	Options ServerOptions `json:"options" bson:"options"`
 }
 
 // ListenConf struct
@@ -50,10 +59,16 @@ type ListenSsl struct {
 	AutoTls    bool     `json:"autotls" bson:"autotls"`
 	Domain     []string `json:"domain" bson:"domain"`
 	ListenAddr string   `json:"listenAddr" bson:"listenAddr"`
-	ListenPort string   `json:"listenPort" bson:"listenPort"`
+	ListenPort string   `json:"listenPort" bson:"listenPort" validate:"omitempty,numeric"`
 	CertFile   string   `json:"certFile" bson:"certFile"`
 	KeyFile    string   `json:"keyFile" bson:"keyFile"`
 	SslOnly    bool     `json:"sslOnly" bson:"sslOnly"`
+	// ClientCaFile is the PEM bundle of the CAs verifying client certificates (mTLS)
+	ClientCaFile string `json:"clientCaFile" bson:"clientCaFile"`
+	// ClientAuth is none, request, requireAny, verifyIfGiven or require, require when only ClientCaFile is set
+	ClientAuth string `json:"clientAuth" bson:"clientAuth" validate:"omitempty,oneof=none request requireAny verifyIfGiven require"`
+	// CertReloadSec is the interval of checking CertFile and KeyFile for changes, 60 seconds by default
+	CertReloadSec int `json:"certReloadSec" bson:"certReloadSec" validate:"min=0"`
 }
 
 // ListenSslConf struct
@@ -66,6 +81,15 @@ type ModeConfg struct {
 	Mode string `json:"mode" bson:"mode"`
 }
 
+func init() {
+	config.RegisterSection("listen", Listen{})
+	config.RegisterSection("ssl", ListenSsl{})
+	config.RegisterSection("cors", CorsOptions{})
+	config.RegisterSection("accessLog", AccessLogOptions{})
+	config.RegisterSection("openapi", OpenApiOptions{})
+	config.RegisterSection("compression", CompressOptions{})
+}
+
 var (
 	// Route variable
 	Route *gin.Engine
@@ -75,6 +99,12 @@ var (
 	ListenSslConfig ListenSslConf
 	// Mode variable
 	Mode ModeConfg
+
+	// currentMode is the gin mode of the current config
+	currentMode atomic.Value
+
+	// reloadOnce registers the validator and the subscriber of the server sections once
+	reloadOnce sync.Once
 )
 
 // Map type
@@ -123,13 +153,70 @@ func LoadServer() {
 	config.GetConf(c.ByteConfig, &ListenSslConfig)
 	config.GetConf(c.ByteConfig, &Mode)
 	config.GetConf(c.ByteConfig, &Cors)
+	config.GetConf(c.ByteConfig, &ListenResourcesConfig)
+	config.GetConf(c.ByteConfig, &AccessLog)
+	config.GetConf(c.ByteConfig, &OpenApi)
+	config.GetConf(c.ByteConfig, &Compress)
 	setMode(Mode)
+	Route.Use(TraceHandler)
+	Route.Use(AccessLogHandler())
+	Route.Use(metricsHandler)
 	Route.Use(latencyHandler)
+	Route.Use(RecoveryHandler)
+	Route.Use(clientCertHandler)
 	Route.Use(CorsHandler())
+	Route.Use(CompressHandler())
+	if OpenApi.OpenApi.Enable {
+		loadOpenApi(Route, OpenApi.OpenApi)
+	}
+	reloadOnce.Do(func() {
+		config.AddValidator(validateServer)
+		config.Subscribe(reloadServer)
+	})
+}
+
+// validateServer function checks the server sections of a reloaded config
+func validateServer(byteConfig []byte) error {
+	for _, v := range []interface{}{&ListenConf{}, &ListenSslConf{}, &ListenResources{}, &ModeConfg{}, &CorsConf{}, &AccessLogConf{}, &OpenApiConf{}, &CompressConf{}} {
+		if err := json.Unmarshal(byteConfig, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Start function
+// reloadServer function applies mode, cors, access log and compression of the reloaded config to the handlers,
+// the Mode, Cors, AccessLog and Compress variables keep the loaded config. The gin mode is kept, the reloaded mode
+// only applies to the debug details of the responses. Listen addresses need a restart.
+func reloadServer(c, _ *config.Config) {
+	var mode ModeConfg
+	var cors CorsConf
+	var accessLog AccessLogConf
+	var compress CompressConf
+	config.GetConf(c.ByteConfig, &mode)
+	config.GetConf(c.ByteConfig, &cors)
+	config.GetConf(c.ByteConfig, &accessLog)
+	config.GetConf(c.ByteConfig, &compress)
+	currentMode.Store(ginMode(mode))
+	corsHandler.Store(newCorsHandler(cors.CorsOptions))
+	storeAccessLog(accessLog.AccessLog)
+	storeCompress(compress.Compress)
+}
+
+// Start function serves the listen section and every listener of listenResources until SIGINT, SIGTERM or Stop,
+// then waits for the graceful shutdown
 func Start() {
+	go handleSignals()
+	startListeners()
+	if hasListen() || len(ListenResourcesConfig.ListenResources) == 0 {
+		startListen()
+	}
+	<-stopped
+}
+
+// startListen function serves Route on the listen and ssl sections
+func startListen() {
 	if ListenConfig.Listen.Ssl {
 		if ListenSslConfig.ListenSsl.AutoTls {
 			m := autocert.Manager{
@@ -140,21 +227,15 @@ func Start() {
 			runWithManager(Route, &m)
 		} else {
 			if ListenSslConfig.ListenSsl.SslOnly == true {
-				if runtime.GOOS == "windows" {
-					ListenSslConfig.ListenSsl.CertFile = path.Join(config.GetConfigDir(), ListenSslConfig.ListenSsl.CertFile)
-					ListenSslConfig.ListenSsl.KeyFile = path.Join(config.GetConfigDir(), ListenSslConfig.ListenSsl.KeyFile)
-				}
+				ListenSslConfig.ListenSsl.resolvePaths()
 				fmt.Println("Listen ssl/tls only")
-				runTLS(ListenSslConfig.ListenSsl.addr(), Route, ListenSslConfig.ListenSsl.CertFile, ListenSslConfig.ListenSsl.KeyFile)
+				runTLS(Route, ListenSslConfig.ListenSsl)
 			} else {
 				go func() {
 					run(Route, ListenConfig.Listen.addr())
 				}()
-				if runtime.GOOS == "windows" {
-					ListenSslConfig.ListenSsl.CertFile = path.Join(config.GetConfigDir(), ListenSslConfig.ListenSsl.CertFile)
-					ListenSslConfig.ListenSsl.KeyFile = path.Join(config.GetConfigDir(), ListenSslConfig.ListenSsl.KeyFile)
-				}
-				runTLS(ListenSslConfig.ListenSsl.addr(), Route, ListenSslConfig.ListenSsl.CertFile, ListenSslConfig.ListenSsl.KeyFile)
+				ListenSslConfig.ListenSsl.resolvePaths()
+				runTLS(Route, ListenSslConfig.ListenSsl)
 			}
 		}
 	} else {
@@ -162,10 +243,13 @@ func Start() {
 	}
 }
 
+// OnStop function registers a hook run on shutdown after in-flight requests are drained,
+// hooks run in reverse order of registration
 func OnStop(f func()) {
 	onShutdown(f)
 }
 
+// Stop function gracefully shuts down the server, see Start
 func Stop() {
 	shutdown()
 }
@@ -214,37 +298,60 @@ func startX() {
 	}
 }
 
+// ginMode function
+func ginMode(modeconfig ModeConfg) string {
+	switch modeconfig.Mode {
+	case "production", "release":
+		return gin.ReleaseMode
+	default:
+		return gin.DebugMode
+	}
+}
+
 // setMode function
 func setMode(modeconfig ModeConfg) {
 	switch modeconfig.Mode {
-	case "production":
+	case "production", "release":
 		gin.SetMode(gin.ReleaseMode)
-		Route = gin.New()
-		Route.NoRoute(NotFoundResponse)
-	case "release":
-		gin.SetMode(gin.ReleaseMode)
-		Route = gin.New()
-		Route.NoRoute(NotFoundResponse)
-	case "development":
-		Route = gin.Default()
-		Route.NoRoute(NotFoundResponse)
-	default:
-		Route = gin.Default()
-		Route.NoRoute(NotFoundResponse)
 	}
+	currentMode.Store(ginMode(modeconfig))
+	Route = newEngine(modeconfig)
+}
+
+// debugging function reports whether the current mode is debug, it follows the reloaded mode
+// while gin.IsDebugging keeps the mode the server was loaded with
+func debugging() bool {
+	if m, ok := currentMode.Load().(string); ok {
+		return m == gin.DebugMode
+	}
+
+	return gin.IsDebugging()
+}
+
+// newEngine function creates an engine for the mode, without the default logger and recovery in release mode
+func newEngine(modeconfig ModeConfg) *gin.Engine {
+	var engine *gin.Engine
+	if ginMode(modeconfig) == gin.ReleaseMode {
+		engine = gin.New()
+	} else {
+		engine = gin.Default()
+	}
+	engine.NoRoute(NotFoundResponse)
+
+	return engine
 }
 
 // NotFoundResponse function
 func NotFoundResponse(c *gin.Context) {
 	c.JSON(404, gin.H{
 		"returnval": false,
-		"error": gin.H{
+		"error": withTrace(c, gin.H{
 			"code":            "404",
 			"message":         "Page Not Found",
 			"message_details": "Page you are looking is not found",
 			"type":            "request",
 			"status":          "PAGE_NOT_FOUND",
-		},
+		}),
 	})
 }
 
@@ -284,7 +391,8 @@ func GinReUnmarshal(i interface{}) (gin.H, error) {
 	return g, nil
 }
 
-// ResponseJSON function
+// ResponseJSON function responds obj in the media type negotiated from the Accept header:
+// JSON by default, MessagePack, CBOR or XML, see content.Negotiate
 func ResponseJSON(c *gin.Context, code int, obj interface{}) {
 	//start response sent :
 	if val, ok := c.Get("x-request-received"); ok && val != nil {
@@ -297,7 +405,24 @@ func ResponseJSON(c *gin.Context, code int, obj interface{}) {
 	if code == 0 {
 		code = 200
 	}
-	c.JSON(code, obj)
+	c.Writer.Header().Add("Vary", "Accept")
+	mediaType := content.Negotiate(c.GetHeader("Accept"))
+	if mediaType == content.MIMEJSON {
+		c.JSON(code, obj)
+		c.Abort()
+		return
+	}
+	b, err := content.Marshal(mediaType, obj)
+	if err != nil {
+		Logf(c, "Response encoding error: %v", err)
+		c.JSON(code, obj)
+		c.Abort()
+		return
+	}
+	if mediaType == content.MIMEXML {
+		mediaType += "; charset=utf-8"
+	}
+	c.Data(code, mediaType, b)
 	c.Abort()
 }
 
@@ -354,45 +479,50 @@ func Error(c *gin.Context, code string, message string, t ...string) gin.H {
 			return gin.H{
 				"kind":      request["kind"],
 				"returnval": false,
-				"error": gin.H{
+				"error": withTrace(c, gin.H{
 					"code":    code,
 					"message": message,
 					"type":    t[0],
-				},
+				}),
 			}
 		}
 		return gin.H{
 			"kind":      request["kind"],
 			"returnval": false,
-			"error": gin.H{
+			"error": withTrace(c, gin.H{
 				"code":    code,
 				"message": message,
-			},
+			}),
 		}
 	}
 	if len(t) > 0 {
 		return gin.H{
 			"returnval": false,
-			"error": gin.H{
+			"error": withTrace(c, gin.H{
 				"code":    code,
 				"message": message,
 				"type":    t[0],
-			},
+			}),
 		}
 	}
 	return gin.H{
 		"returnval": false,
-		"error": gin.H{
+		"error": withTrace(c, gin.H{
 			"code":    code,
 			"message": message,
-		},
+		}),
 	}
 }
 
-// ErrorResponse function
-func ErrorResponse(code string, message string) gin.H {
-	return gin.H{
+// ErrorResponse function, the request ID and trace ID are added when the request context is given
+func ErrorResponse(code string, message string, c ...*gin.Context) gin.H {
+	body := gin.H{
 		"code":    code,
 		"message": message,
 	}
+	if len(c) > 0 {
+		return withTrace(c[0], body)
+	}
+
+	return body
 }
@@ -14,22 +14,24 @@
 package server
 
 import (
+	"errors"
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/memcached"
 	"github.com/gin-contrib/sessions/redis"
 	"github.com/gin-gonic/gin"
 	"github.com/jasacloud/go-libraries/config"
+	"log"
 )
 
 // SessionOption struct
 type SessionOption struct {
-	Name          string `json:"name" bson:"name"`
-	Type          string `json:"type" bson:"type"`
-	Host          string `json:"host" bson:"host"`
-	Secret        string `json:"secret" bson:"secret"`
+	Name          string `json:"name" bson:"name" validate:"required"`
+	Type          string `json:"type" bson:"type" validate:"required,oneof=memcached redis"`
+	Host          string `json:"host" bson:"host" validate:"required"`
+	Secret        string `json:"secret" bson:"secret" secret:"true"`
 	Username      string `json:"username" bson:"username"`
-	Password      string `json:"password" bson:"password"`
+	Password      string `json:"password" bson:"password" secret:"true"`
 	ExpirationSec int    `json:"expiration" bson:"expiration"`
 	SessionName   string `json:"sessionName" bson:"sessionName"`
 }
@@ -39,8 +41,12 @@ type SessionConf struct {
 	SessionOption []SessionOption `json:"sessionResources" bson:"sessionResources"`
 }
 
+func init() {
+	config.RegisterResources("sessionResources", SessionOption{})
+}
+
 var (
-	// Sess variable
+	// Sess variable is not updated anymore, use GetSessionResource which reads the current config
 	Sess SessionConf
 )
 
@@ -49,16 +55,12 @@ var sessionStore = make(map[string]gin.HandlerFunc)
 
 // GetSessionResource function
 func GetSessionResource(resourceName string) SessionOption {
-	c := config.GetConfig()
-	config.GetConf(c.ByteConfig, &Sess)
-	for _, v := range Sess.SessionOption {
-		if v.Name == resourceName {
-
-			return v
-		}
+	r, err := config.Resource[SessionOption]("sessionResources", resourceName)
+	if err != nil && !errors.Is(err, config.ErrResourceNotFound) {
+		log.Println("failed load session resource "+resourceName+", error: ", err)
 	}
 
-	return SessionOption{}
+	return r
 }
 
 // GetSessionStore function
@@ -0,0 +1,215 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/config"
+	"log"
+	"os"
+	"path"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// ClientSubjectKey constant is the gin context key of the verified client certificate subject
+	ClientSubjectKey string = "x-client-subject"
+	// ClientCertificateKey constant is the gin context key of the verified client *x509.Certificate
+	ClientCertificateKey string = "x-client-certificate"
+	// DefaultCertReload constant is the default interval of checking the cert and key files for changes
+	DefaultCertReload = time.Minute
+)
+
+// clientAuthTypes variable maps the clientAuth setting to the tls client authentication
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":          tls.NoClientCert,
+	"request":       tls.RequestClientCert,
+	"requireAny":    tls.RequireAnyClientCert,
+	"verifyIfGiven": tls.VerifyClientCertIfGiven,
+	"require":       tls.RequireAndVerifyClientCert,
+}
+
+// resolvePaths method joins the files with the config dir on windows
+func (l *ListenSsl) resolvePaths() {
+	if runtime.GOOS != "windows" {
+		return
+	}
+	for _, f := range []*string{&l.CertFile, &l.KeyFile, &l.ClientCaFile} {
+		if *f != "" {
+			*f = path.Join(config.GetConfigDir(), *f)
+		}
+	}
+}
+
+// tlsConfig method builds the server tls config, the key pair is reloaded when its files change.
+// A client CA bundle without clientAuth requires and verifies the client certificates.
+func (l ListenSsl) tlsConfig() (*tls.Config, error) {
+	interval := DefaultCertReload
+	if l.CertReloadSec > 0 {
+		interval = time.Duration(l.CertReloadSec) * time.Second
+	}
+	reloader, err := newCertReloader(l.CertFile, l.KeyFile, interval)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	clientAuth := l.ClientAuth
+	if clientAuth == "" && l.ClientCaFile != "" {
+		clientAuth = "require"
+	}
+	if clientAuth != "" {
+		t, ok := clientAuthTypes[clientAuth]
+		if !ok {
+			return nil, fmt.Errorf("unknown clientAuth %q", clientAuth)
+		}
+		tlsConfig.ClientAuth = t
+	}
+	if l.ClientCaFile != "" {
+		b, err := os.ReadFile(l.ClientCaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificate found in %s", l.ClientCaFile)
+		}
+		tlsConfig.ClientCAs = pool
+	} else if tlsConfig.ClientAuth == tls.VerifyClientCertIfGiven || tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+		return nil, errors.New("clientAuth " + clientAuth + " needs clientCaFile")
+	}
+
+	return tlsConfig, nil
+}
+
+// certReloader struct serves the key pair and reloads it when the cert or key file changes
+type certReloader struct {
+	mu       sync.Mutex
+	certFile string
+	keyFile  string
+	interval time.Duration
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+// newCertReloader function
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		checked:  time.Now(),
+	}
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate method checks the files at most once per interval, a failed reload keeps the previous pair
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= r.interval {
+		r.checked = time.Now()
+		modTime, err := r.lastModified()
+		if err != nil {
+			log.Printf("failed check certificate %s: %v", r.certFile, err)
+		} else if !modTime.Equal(r.modTime) {
+			if err := r.load(modTime); err != nil {
+				// the key may not be written yet, retry on the next check
+				log.Printf("failed reload certificate %s: %v", r.certFile, err)
+			} else {
+				log.Printf("certificate %s reloaded", r.certFile)
+			}
+		}
+	}
+
+	return r.cert, nil
+}
+
+// load method
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+
+	return nil
+}
+
+// lastModified method returns the latest modification time of the cert and key files
+func (r *certReloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return modTime, err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+
+	return modTime, nil
+}
+
+// clientCertHandler function sets the verified client certificate and its subject in the context
+func clientCertHandler(c *gin.Context) {
+	if tlsState := c.Request.TLS; tlsState != nil && len(tlsState.VerifiedChains) > 0 && len(tlsState.VerifiedChains[0]) > 0 {
+		cert := tlsState.VerifiedChains[0][0]
+		c.Set(ClientCertificateKey, cert)
+		c.Set(ClientSubjectKey, cert.Subject.String())
+	}
+	c.Next()
+}
+
+// ClientSubject function returns the subject of the verified client certificate, e.g. "CN=billing,O=Jasa"
+func ClientSubject(c *gin.Context) (string, bool) {
+	v, ok := c.Get(ClientSubjectKey)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+
+	return s, ok
+}
+
+// ClientCertificate function returns the verified client certificate
+func ClientCertificate(c *gin.Context) (*x509.Certificate, bool) {
+	v, ok := c.Get(ClientCertificateKey)
+	if !ok {
+		return nil, false
+	}
+	cert, ok := v.(*x509.Certificate)
+
+	return cert, ok
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jasacloud/go-libraries/utils/tracing"
+	"log"
+)
+
+// RequestIDKey constant is the gin context key of the request ID
+const RequestIDKey string = "x-request-id"
+
+// TraceHandler function accepts or generates the X-Request-ID and traceparent of the request,
+// stores them in the context and the request context, and returns them in the response headers.
+// Pass c.Request.Context() to client.Http SetContext to forward them on outbound calls, also from
+// the goroutines started by the handler, other requests get them with tracing.FromContext and Inject.
+func TraceHandler(c *gin.Context) {
+	t := tracing.FromHeader(c.Request.Header)
+	c.Set(RequestIDKey, t.RequestID)
+	c.Set(tracing.ContextKey, t)
+	c.Request = c.Request.WithContext(tracing.NewContext(c.Request.Context(), t))
+	c.Writer.Header().Set(tracing.RequestIDHeader, t.RequestID)
+	c.Writer.Header().Set(tracing.TraceparentHeader, t.Traceparent())
+	c.Next()
+}
+
+// GetTrace function returns the trace of the request
+func GetTrace(c *gin.Context) (tracing.Trace, bool) {
+	if c == nil {
+		return tracing.Trace{}, false
+	}
+
+	return tracing.FromContext(c)
+}
+
+// Logf function logs the message prefixed with the request ID and trace ID of the request
+func Logf(c *gin.Context, format string, v ...interface{}) {
+	if t, ok := GetTrace(c); ok {
+		format = t.String() + " " + format
+	}
+	log.Printf(format, v...)
+}
+
+// withTrace function adds the request ID and trace ID of the request to the error body
+func withTrace(c *gin.Context, body gin.H) gin.H {
+	if t, ok := GetTrace(c); ok {
+		body["request_id"] = t.RequestID
+		body["trace_id"] = t.TraceID
+	}
+
+	return body
+}
@@ -320,3 +320,54 @@ func DecryptAes(key []byte, securemess string) (decodedmess string, err error) {
 	decodedmess = string(cipherText)
 	return
 }
+
+// EncryptAesGcm function encrypts and authenticates message with AES-GCM, the nonce is put at the beginning of the ciphertext
+func EncryptAesGcm(key []byte, message string) (encmess string, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+
+	//returns to base64 encoded string
+	encmess = base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(message), nil))
+	return
+}
+
+// DecryptAesGcm function decrypts the EncryptAesGcm ciphertext, it fails when the key is wrong or the ciphertext was modified
+func DecryptAesGcm(key []byte, securemess string) (decodedmess string, err error) {
+	cipherText, err := base64.StdEncoding.DecodeString(securemess)
+	if err != nil {
+		return
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return
+	}
+
+	if len(cipherText) < gcm.NonceSize() {
+		err = errors.New("Ciphertext block size is too short!")
+		return
+	}
+
+	plainText, err := gcm.Open(nil, cipherText[:gcm.NonceSize()], cipherText[gcm.NonceSize():], nil)
+	if err != nil {
+		return
+	}
+
+	decodedmess = string(plainText)
+	return
+}
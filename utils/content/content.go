@@ -0,0 +1,212 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package content encodes and decodes the api envelopes in JSON, MessagePack, CBOR and XML.
+// Every format carries the JSON document of the value: the json tags name the fields and the
+// json marshalers apply, so a client receives the same document whatever the format it accepts.
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/ugorji/go/codec"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MIMEJSON constant
+	MIMEJSON string = "application/json"
+	// MIMEMsgPack constant
+	MIMEMsgPack string = "application/msgpack"
+	// MIMECBOR constant
+	MIMECBOR string = "application/cbor"
+	// MIMEXML constant
+	MIMEXML string = "application/xml"
+)
+
+// ErrUnsupported variable
+var ErrUnsupported = errors.New("unsupported media type")
+
+// aliases of the supported media types
+var aliases = map[string]string{
+	MIMEJSON:                  MIMEJSON,
+	"text/json":               MIMEJSON,
+	MIMEMsgPack:               MIMEMsgPack,
+	"application/x-msgpack":   MIMEMsgPack,
+	"application/vnd.msgpack": MIMEMsgPack,
+	MIMECBOR:                  MIMECBOR,
+	MIMEXML:                   MIMEXML,
+	"text/xml":                MIMEXML,
+}
+
+var (
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+	cborHandle    = &codec.CborHandle{}
+)
+
+func init() {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+	msgpackHandle.MapType = mapType
+	msgpackHandle.RawToString = true
+	cborHandle.MapType = mapType
+}
+
+// MediaType function returns the supported media type of the Content-Type header, empty when unsupported
+func MediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return aliases[t]
+}
+
+// Negotiate function returns the supported media type preferred by the Accept header,
+// JSON when the header is empty, accepts any type or accepts no supported type
+func Negotiate(accept string) string {
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var list []accepted
+	for _, part := range strings.Split(accept, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			list = append(list, accepted{t, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+	for _, a := range list {
+		if a.mediaType == "*/*" || a.mediaType == "application/*" {
+			return MIMEJSON
+		}
+		if t := aliases[a.mediaType]; t != "" {
+			return t
+		}
+	}
+
+	return MIMEJSON
+}
+
+// Marshal function encodes v in the media type
+func Marshal(mediaType string, v interface{}) ([]byte, error) {
+	if mediaType == MIMEJSON {
+		return json.Marshal(v)
+	}
+	doc, err := document(v)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	switch mediaType {
+	case MIMEMsgPack:
+		err = codec.NewEncoderBytes(&b, msgpackHandle).Encode(doc)
+	case MIMECBOR:
+		err = codec.NewEncoderBytes(&b, cborHandle).Encode(doc)
+	case MIMEXML:
+		b, err = marshalXML(doc)
+	default:
+		err = ErrUnsupported
+	}
+
+	return b, err
+}
+
+// ToJSON function decodes the data of the media type and returns its JSON document,
+// to bind it like a JSON body
+func ToJSON(mediaType string, data []byte) ([]byte, error) {
+	var doc interface{}
+	var err error
+	switch mediaType {
+	case MIMEJSON:
+		return data, nil
+	case MIMEMsgPack:
+		err = codec.NewDecoderBytes(data, msgpackHandle).Decode(&doc)
+	case MIMECBOR:
+		err = codec.NewDecoderBytes(data, cborHandle).Decode(&doc)
+	case MIMEXML:
+		doc, err = unmarshalXML(data)
+	default:
+		err = ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+// Unmarshal function decodes the data of the media type into v as its JSON document would be
+func Unmarshal(mediaType string, data []byte, v interface{}) error {
+	b, err := ToJSON(mediaType, data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// document function returns the JSON document of v as maps, slices and scalars,
+// the integers are kept as int64 so the binary formats encode them as integers
+func document(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var doc interface{}
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return numbers(doc), nil
+}
+
+// numbers function replaces the json.Number of the document by int64 or float64
+func numbers(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			n[k] = numbers(v)
+		}
+	case []interface{}:
+		for i, v := range n {
+			n[i] = numbers(v)
+		}
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		f, _ := n.Float64()
+		return f
+	}
+
+	return node
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// XMLRoot variable is the name of the root element of the encoded documents
+var XMLRoot = "response"
+
+// The JSON document is mapped to elements: an object field is a child element of its name,
+// an array element is an <item> child and a field whose name is not an XML name is an <entry key="...">.
+// The type attribute keeps the numbers, booleans, empty objects, arrays and nulls apart from strings:
+//
+//	<response><returnval type="boolean">true</returnval><values><tags type="array"><item>a</item></tags></values></response>
+const (
+	xmlItem  = "item"
+	xmlEntry = "entry"
+)
+
+// xmlName matches the field names usable as element names
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// marshalXML function
+func marshalXML(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	e := xml.NewEncoder(&buf)
+	if err := encodeXML(e, xml.StartElement{Name: xml.Name{Local: XMLRoot}}, doc); err != nil {
+		return nil, err
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeXML function
+func encodeXML(e *xml.Encoder, start xml.StartElement, node interface{}) error {
+	var text string
+	switch n := node.(type) {
+	case nil:
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: "null"})
+	case bool:
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: "boolean"})
+		text = strconv.FormatBool(n)
+	case int64:
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: "number"})
+		text = strconv.FormatInt(n, 10)
+	case float64:
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: "number"})
+		text = strconv.FormatFloat(n, 'g', -1, 64)
+	case string:
+		text = n
+	case []interface{}:
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: "array"})
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, v := range n {
+			if err := encodeXML(e, xml.StartElement{Name: xml.Name{Local: xmlItem}}, v); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case map[string]interface{}:
+		if len(n) == 0 {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: "object"})
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(n))
+		for k := range n {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !xmlName.MatchString(k) || strings.HasPrefix(strings.ToLower(k), "xml") || k == xmlItem || k == xmlEntry {
+				child = xml.StartElement{
+					Name: xml.Name{Local: xmlEntry},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+			if err := encodeXML(e, child, n[k]); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	default:
+		return errors.New("unexpected xml document node")
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if text != "" {
+		if err := e.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// xmlNode struct
+type xmlNode struct {
+	key      string
+	typ      string
+	text     strings.Builder
+	children []*xmlNode
+}
+
+// unmarshalXML function returns the JSON document of the root element
+func unmarshalXML(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{key: t.Name.Local}
+			for _, a := range t.Attr {
+				switch a.Name.Local {
+				case "type":
+					n.typ = a.Value
+				case "key":
+					if t.Name.Local == xmlEntry {
+						n.key = a.Value
+					}
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("empty xml document")
+	}
+
+	return root.value()
+}
+
+// value method
+func (n *xmlNode) value() (interface{}, error) {
+	text := n.text.String()
+	switch n.typ {
+	case "null":
+		return nil, nil
+	case "boolean":
+		return strconv.ParseBool(strings.TrimSpace(text))
+	case "number":
+		return json.Number(strings.TrimSpace(text)), nil
+	case "array":
+		a := make([]interface{}, 0, len(n.children))
+		for _, c := range n.children {
+			v, err := c.value()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case "object":
+		if len(n.children) == 0 {
+			return map[string]interface{}{}, nil
+		}
+	}
+	if len(n.children) == 0 {
+		return text, nil
+	}
+	m := make(map[string]interface{}, len(n.children))
+	for _, c := range n.children {
+		v, err := c.value()
+		if err != nil {
+			return nil, err
+		}
+		// repeated elements without type="array" are collected as an array
+		if prev, ok := m[c.key]; ok {
+			if a, ok := prev.([]interface{}); ok && c.typ != "array" {
+				m[c.key] = append(a, v)
+			} else {
+				m[c.key] = []interface{}{prev, v}
+			}
+			continue
+		}
+		m[c.key] = v
+	}
+
+	return m, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2019 JasaCloud.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing carries the request ID and the W3C trace context of a request,
+// see https://www.w3.org/TR/trace-context/
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// RequestIDHeader constant
+	RequestIDHeader string = "X-Request-ID"
+	// TraceparentHeader constant
+	TraceparentHeader string = "traceparent"
+	// TracestateHeader constant
+	TracestateHeader string = "tracestate"
+	// ContextKey constant is the key of the Trace in gin.Context
+	ContextKey string = "x-trace"
+)
+
+// Trace struct is the correlation of a request, SpanID is the span of the current service
+type Trace struct {
+	RequestID string `json:"requestId"`
+	TraceID   string `json:"traceId"`
+	SpanID    string `json:"spanId"`
+	Flags     string `json:"flags"`
+	State     string `json:"state,omitempty"`
+}
+
+// contextKey type
+type contextKey struct{}
+
+// NewContext function returns a copy of ctx carrying the trace
+func NewContext(ctx context.Context, t Trace) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext function returns the trace of ctx, a *gin.Context works too
+func FromContext(ctx context.Context) (Trace, bool) {
+	if ctx == nil {
+		return Trace{}, false
+	}
+	if t, ok := ctx.Value(contextKey{}).(Trace); ok {
+		return t, true
+	}
+	t, ok := ctx.Value(ContextKey).(Trace)
+
+	return t, ok
+}
+
+// FromHeader function continues the trace of the incoming headers with a new span,
+// the request ID and the trace are generated when missing or invalid
+func FromHeader(h http.Header) Trace {
+	t := Trace{RequestID: h.Get(RequestIDHeader)}
+	if !validRequestID(t.RequestID) {
+		t.RequestID = NewRequestID()
+	}
+	if traceID, _, flags, ok := ParseTraceparent(h.Get(TraceparentHeader)); ok {
+		t.TraceID = traceID
+		t.Flags = flags
+		t.State = h.Get(TracestateHeader)
+	} else {
+		t.TraceID = randomHex(16)
+		t.Flags = "01"
+	}
+	t.SpanID = randomHex(8)
+
+	return t
+}
+
+// Traceparent method returns the traceparent header value of the current span
+func (t Trace) Traceparent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// Inject method sets the request ID and the trace context headers of an outbound request
+func (t Trace) Inject(h http.Header) {
+	if t.RequestID != "" {
+		h.Set(RequestIDHeader, t.RequestID)
+	}
+	if t.TraceID != "" {
+		h.Set(TraceparentHeader, t.Traceparent())
+		if t.State != "" {
+			h.Set(TracestateHeader, t.State)
+		}
+	}
+}
+
+// String method returns the log prefix of the trace
+func (t Trace) String() string {
+	return fmt.Sprintf("[%s %s]", t.RequestID, t.TraceID)
+}
+
+// ParseTraceparent function parses a version 00 traceparent header value
+func ParseTraceparent(v string) (traceID, parentID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || parts[0] == "ff" || len(parts[0]) != 2 || (parts[0] == "00" && len(parts) != 4) {
+		return "", "", "", false
+	}
+	traceID, parentID, flags = parts[1], parts[2], parts[3]
+	if !isHex(traceID, 32) || !isHex(parentID, 16) || !isHex(flags, 2) ||
+		strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return "", "", "", false
+	}
+
+	return traceID, parentID, flags, true
+}
+
+// NewRequestID function returns a random UUID version 4
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randomHex function
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// isHex function reports whether s is n lowercase hex digits
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validRequestID function accepts up to 128 printable ascii characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}